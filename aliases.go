@@ -17,11 +17,7 @@ package flagfile
 import (
 	"flag"
 	"fmt"
-)
-
-var (
-	all_aliases = make(map[string][]string)
-	alias_set   = make(map[string]bool)
+	"sort"
 )
 
 // Alias links two flag names together. If you have a particular flag that
@@ -29,71 +25,143 @@ var (
 // in another deployment, Alias lets you link the two flag names together. It
 // is an error to configure both aliases with differing values.
 func Alias(new_flag_name, old_flag_name string) {
-	mtx.Lock()
-	defer mtx.Unlock()
-	if loaded {
+	CommandLine.Alias(new_flag_name, old_flag_name)
+}
+
+// IsAlias returns true if the flag name is just an alias. False if the flag
+// was defined normally.
+func IsAlias(flag_name string) bool {
+	return CommandLine.IsAlias(flag_name)
+}
+
+// Alias links two flag names of the Loader's flag set together. See the
+// top-level Alias.
+func (l *Loader) Alias(new_flag_name, old_flag_name string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.loaded {
 		panic(fmt.Errorf("flags already loaded"))
 	}
-	alias_set[new_flag_name] = true
-	all_aliases[old_flag_name] = append(
-		all_aliases[old_flag_name], new_flag_name)
+	l.alias_set[new_flag_name] = true
+	l.all_aliases[old_flag_name] = append(
+		l.all_aliases[old_flag_name], new_flag_name)
 }
 
-func isAlias(flag_name string) bool {
-	return alias_set[flag_name]
+func (l *Loader) isAlias(flag_name string) bool {
+	return l.alias_set[flag_name]
 }
 
 // IsAlias returns true if the flag name is just an alias. False if the flag
 // was defined normally.
-func IsAlias(flag_name string) bool {
-	mtx.Lock()
-	defer mtx.Unlock()
-	return isAlias(flag_name)
+func (l *Loader) IsAlias(flag_name string) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.isAlias(flag_name)
 }
 
-func mustLookup(flag_name string) *flag.Flag {
-	val := flag.Lookup(flag_name)
+func (l *Loader) mustLookup(flag_name string) *flag.Flag {
+	val := l.fs.Lookup(flag_name)
 	if val == nil {
 		panic(fmt.Errorf("flag %#v doesn't exist", flag_name))
 	}
 	return val
 }
 
-func defineAliases() {
-	for flag_name, flag_aliases := range all_aliases {
-		existing_flag := flag.Lookup(flag_name)
+func (l *Loader) defineAliases() error {
+	names := make([]string, 0, len(l.all_aliases))
+	for flag_name := range l.all_aliases {
+		names = append(names, flag_name)
+	}
+	sort.Strings(names)
+	for _, flag_name := range names {
+		existing_flag := l.fs.Lookup(flag_name)
 		if existing_flag == nil {
-			panic(fmt.Errorf("alias defined pointing to a non-existent flag %#v",
-				flag_name))
+			return &DefinitionError{Name: flag_name, Err: fmt.Errorf(
+				"alias defined pointing to a non-existent flag")}
+		}
+		for _, alias := range l.all_aliases[flag_name] {
+			if l.fs.Lookup(alias) != nil {
+				return &DefinitionError{Name: alias, Err: fmt.Errorf(
+					"alias of %#v is already defined", flag_name)}
+			}
+			l.fs.Var(existing_flag.Value, alias, existing_flag.Usage)
+		}
+	}
+	return nil
+}
+
+// aliasGroup returns every name that shares a value with the given flag name.
+func (l *Loader) aliasGroup(flag_name string) []string {
+	for name, flag_aliases := range l.all_aliases {
+		if name == flag_name || containsString(flag_aliases, flag_name) {
+			return append([]string{name}, flag_aliases...)
 		}
-		for _, alias := range flag_aliases {
-			flag.Var(existing_flag.Value, alias, existing_flag.Usage)
+	}
+	return []string{flag_name}
+}
+
+// anySet returns whether any of the given flag names was actively set.
+func (l *Loader) anySet(flag_names []string) bool {
+	for _, flag_name := range flag_names {
+		if l.set_flags[flag_name] {
+			return true
 		}
 	}
+	return false
 }
 
-func setAliases() {
-	for flag_name, flag_aliases := range all_aliases {
+func containsString(list []string, val string) bool {
+	for _, item := range list {
+		if item == val {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAliases returns an error if more than one name of an aliased flag is
+// in the given set.
+func (l *Loader) checkAliases(set map[string]bool) error {
+	for flag_name, flag_aliases := range l.all_aliases {
+		var set_aliases []string
+		for _, flag := range append([]string{flag_name}, flag_aliases...) {
+			if set[flag] {
+				set_aliases = append(set_aliases, flag)
+			}
+		}
+		if len(set_aliases) > 1 {
+			return &AliasConflictError{Name: flag_name, Aliases: set_aliases}
+		}
+	}
+	return nil
+}
+
+func (l *Loader) setAliases() error {
+	err := l.checkAliases(l.set_flags)
+	if err != nil {
+		return err
+	}
+	for flag_name, flag_aliases := range l.all_aliases {
 		flags := append([]string{flag_name}, flag_aliases...)
-		var set_alias *string
+		var set_alias string
 		for _, flag := range flags {
-			if !set_flags[flag] {
-				continue
+			if l.set_flags[flag] {
+				set_alias = flag
 			}
-			if set_alias != nil {
-				panic(fmt.Errorf("multiple aliases of flag %#v set", flag_name))
-			}
-			set_alias = &flag
 		}
-		if set_alias == nil {
+		if set_alias == "" {
 			continue
 		}
-		set_alias_val := mustLookup(*set_alias).Value.String()
+		set_alias_val := l.mustLookup(set_alias).Value.String()
 		for _, flag := range flags {
-			if set_flags[flag] {
+			if l.set_flags[flag] {
 				continue
 			}
-			mustSet(flag, set_alias_val)
+			err := l.setFlag(flag, Entry{Value: set_alias_val})
+			if err != nil {
+				return err
+			}
 		}
 	}
+	return nil
 }
@@ -0,0 +1,82 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"strings"
+)
+
+// InterspersedArgs tells Load to keep parsing flags after positional
+// arguments, so that "tool file.txt -verbose" sets -verbose, instead of
+// stopping at the first positional argument like flag.Parse. Everything after
+// "--" or the name of a subcommand (see Command) is still positional.
+func InterspersedArgs() Option {
+	return Option{interspersed: true}
+}
+
+// Args returns the positional arguments left after Load parsed the command
+// line.
+func Args() []string {
+	return CommandLine.Args()
+}
+
+// Args returns the positional arguments left after Load parsed the command
+// line. They are also available from the flag set's Args method.
+func (l *Loader) Args() []string {
+	return l.fs.Args()
+}
+
+// splitArgs splits command line arguments into flags, along with their
+// values, and positional arguments, following the rules of flag.Parse, or of
+// InterspersedArgs if interspersed. The "--" separating them is dropped.
+func (l *Loader) splitArgs(args []string, interspersed bool) (
+	flag_args, positionals []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return flag_args, append(positionals, args[i+1:]...)
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			if _, ok := l.commands[arg]; ok || !interspersed {
+				return flag_args, append(positionals, args[i:]...)
+			}
+			positionals = append(positionals, arg)
+			continue
+		}
+		flag_args = append(flag_args, arg)
+		if l.takesValue(arg) && i+1 < len(args) {
+			i++
+			flag_args = append(flag_args, args[i])
+		}
+	}
+	return flag_args, positionals
+}
+
+// takesValue returns whether the flag argument arg is followed by its value
+// as a separate argument.
+func (l *Loader) takesValue(arg string) bool {
+	name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+	if name == "" || strings.Contains(name, "=") {
+		return false
+	}
+	f := l.fs.Lookup(name)
+	if f == nil {
+		return false
+	}
+	b, ok := f.Value.(interface {
+		IsBoolFlag() bool
+	})
+	return !ok || !b.IsBoolFlag()
+}
@@ -0,0 +1,158 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// commandPrefix starts the names of subcommand flags in flagfiles.
+const commandPrefix = "cmd."
+
+// command is a subcommand registered with Command.
+type command struct {
+	name   string
+	loader *Loader
+	run    func(args []string) error
+}
+
+// Command registers a subcommand. See Loader.Command.
+func Command(name string, setup func(*flag.FlagSet),
+	run func(args []string) error) {
+	CommandLine.Command(name, setup, run)
+}
+
+// Run dispatches to the subcommand named on the command line. See
+// Loader.Run.
+func Run() error {
+	return CommandLine.Run()
+}
+
+// Command registers a subcommand called name. setup is called with the
+// subcommand's own flag set to define its flags, which may be set on the
+// command line after the subcommand's name, or in flagfiles under the
+// section [cmd.name]. Once flags are loaded, Run calls run with the
+// arguments left after the subcommand's flags.
+func (l *Loader) Command(name string, setup func(*flag.FlagSet),
+	run func(args []string) error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.loaded {
+		panic(fmt.Errorf("flags already loaded"))
+	}
+	if _, ok := l.commands[name]; ok {
+		panic(fmt.Errorf("command %#v already registered", name))
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	setup(fs)
+	l.commands[name] = &command{name: name, loader: newLoader(fs), run: run}
+}
+
+// Run dispatches to the subcommand named by the first argument left after
+// Load parsed the global flags. It loads the subcommand's flags from the
+// arguments that follow and from the flagfiles' [cmd.name] sections, then
+// calls the subcommand's run function and returns its error.
+func (l *Loader) Run() error {
+	l.mtx.Lock()
+	if !l.loaded {
+		l.mtx.Unlock()
+		return fmt.Errorf("flags not loaded")
+	}
+	args := l.fs.Args()
+	interspersed := l.cfg.interspersed
+	var cmd *command
+	var entries map[string]Entry
+	if len(args) > 0 {
+		cmd = l.commands[args[0]]
+		entries = l.command_entries[args[0]]
+	}
+	short_usage := l.cfg.short_usage
+	l.mtx.Unlock()
+
+	if len(args) == 0 {
+		short_usage()
+		return fmt.Errorf("no command given")
+	}
+	if cmd == nil {
+		short_usage()
+		return fmt.Errorf("unknown command %#v", args[0])
+	}
+	err := cmd.loader.LoadE(Arguments(args[1:]), Sources(
+		CommandLineSource(), &entrySource{entries: entries}, DefaultSource()),
+		Option{interspersed: interspersed})
+	if err != nil {
+		return err
+	}
+	return cmd.run(cmd.loader.fs.Args())
+}
+
+// sortedCommands returns the registered subcommands sorted by name.
+func (l *Loader) sortedCommands() []*command {
+	names := make([]string, 0, len(l.commands))
+	for name := range l.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cmds := make([]*command, 0, len(names))
+	for _, name := range names {
+		cmds = append(cmds, l.commands[name])
+	}
+	return cmds
+}
+
+// takeCommandEntries removes the values for registered subcommands' flags
+// from values and returns the active ones, keyed by subcommand and flag name.
+func (l *Loader) takeCommandEntries(
+	values map[string]value) map[string]map[string]Entry {
+	entries := make(map[string]map[string]Entry)
+	for name, val := range values {
+		if !strings.HasPrefix(name, commandPrefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(name, commandPrefix)
+		pos := strings.Index(rest, ".")
+		if pos == -1 {
+			continue
+		}
+		cmd_name, flag_name := rest[:pos], rest[pos+1:]
+		if _, ok := l.commands[cmd_name]; !ok {
+			continue
+		}
+		delete(values, name)
+		if !val.active() {
+			continue
+		}
+		if entries[cmd_name] == nil {
+			entries[cmd_name] = make(map[string]Entry)
+		}
+		entries[cmd_name][flag_name] = val.entry
+	}
+	return entries
+}
+
+// entrySource is a Source for a subcommand's flags found in flagfiles.
+type entrySource struct {
+	entries map[string]Entry
+}
+
+func (s *entrySource) Name() string { return "file" }
+
+func (s *entrySource) Load(ctx context.Context) (map[string]Entry, error) {
+	return s.entries, nil
+}
@@ -0,0 +1,135 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConstraintKind is the kind of relationship a constraint imposes between
+// flags.
+type ConstraintKind int
+
+const (
+	// Exclusive means at most one of the flags may be set.
+	Exclusive ConstraintKind = iota
+	// Together means either all or none of the flags must be set.
+	Together
+	// Implication means that if the first flag is set, so must the second.
+	Implication
+)
+
+// constraint is a relationship between whether flags are actively set.
+type constraint struct {
+	kind  ConstraintKind
+	names []string
+}
+
+func (c constraint) String() string {
+	dashed := make([]string, 0, len(c.names))
+	for _, name := range c.names {
+		dashed = append(dashed, "-"+name)
+	}
+	switch c.kind {
+	case Exclusive:
+		return fmt.Sprintf("only one of %s may be set",
+			strings.Join(dashed, ", "))
+	case Together:
+		return fmt.Sprintf("%s must be set together",
+			strings.Join(dashed, ", "))
+	default:
+		return fmt.Sprintf("%s requires %s", dashed[0], dashed[1])
+	}
+}
+
+// MutuallyExclusive declares that at most one of the named flags may be
+// actively set. Load fails with ConstraintErrors describing every violated
+// constraint.
+func MutuallyExclusive(flag_names ...string) {
+	CommandLine.MutuallyExclusive(flag_names...)
+}
+
+// RequiredTogether declares that if any of the named flags is actively set,
+// all of them must be.
+func RequiredTogether(flag_names ...string) {
+	CommandLine.RequiredTogether(flag_names...)
+}
+
+// Implies declares that if flag a is actively set, flag b must be too.
+func Implies(a, b string) {
+	CommandLine.Implies(a, b)
+}
+
+// MutuallyExclusive declares that at most one of the named flags may be
+// actively set. See the top-level MutuallyExclusive.
+func (l *Loader) MutuallyExclusive(flag_names ...string) {
+	l.constrain(Exclusive, flag_names)
+}
+
+// RequiredTogether declares that if any of the named flags is actively set,
+// all of them must be.
+func (l *Loader) RequiredTogether(flag_names ...string) {
+	l.constrain(Together, flag_names)
+}
+
+// Implies declares that if flag a is actively set, flag b must be too.
+func (l *Loader) Implies(a, b string) {
+	l.constrain(Implication, []string{a, b})
+}
+
+func (l *Loader) constrain(kind ConstraintKind, flag_names []string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.loaded {
+		panic(fmt.Errorf("flags already loaded"))
+	}
+	l.constraints = append(l.constraints, constraint{
+		kind: kind, names: append([]string(nil), flag_names...)})
+}
+
+// checkConstraints returns an error describing every constraint violated by
+// the given set of flags, counting a flag as set if any of its aliases is.
+func (l *Loader) checkConstraints(set map[string]bool) error {
+	var errs ConstraintErrors
+	for _, c := range l.constraints {
+		var set_names []string
+		for _, name := range c.names {
+			for _, alias := range l.aliasGroup(name) {
+				if set[alias] {
+					set_names = append(set_names, name)
+					break
+				}
+			}
+		}
+		var violated bool
+		switch c.kind {
+		case Exclusive:
+			violated = len(set_names) > 1
+		case Together:
+			violated = len(set_names) > 0 && len(set_names) < len(c.names)
+		case Implication:
+			violated = len(set_names) == 1 && set_names[0] == c.names[0]
+		}
+		if violated {
+			errs = append(errs, &ConstraintError{Kind: c.kind, Names: c.names,
+				Set: set_names})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
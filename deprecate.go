@@ -0,0 +1,137 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// deprecation describes a flag name that is being retired.
+type deprecation struct {
+	replacement string
+	message     string
+}
+
+// Deprecate retires the flag name old in favor of the flag replacement.
+// Values given for old on the command line, in the environment or in
+// flagfiles are forwarded to replacement, along with a logged warning that
+// includes message and where old was used. Unlike with Alias, a value given
+// for replacement in the same flagfile or environment takes precedence, and
+// giving both on the command line is an error. Use StrictDeprecations to
+// make using old an error instead.
+func Deprecate(old, replacement, message string) {
+	CommandLine.Deprecate(old, replacement, message)
+}
+
+// IsDeprecated returns true if the flag name is deprecated.
+func IsDeprecated(flag_name string) bool {
+	return CommandLine.IsDeprecated(flag_name)
+}
+
+// StrictDeprecations tells Load to fail with a *DeprecatedFlagError if a
+// deprecated flag name is used, instead of logging a warning.
+func StrictDeprecations() Option {
+	return Option{strictDeprecations: true}
+}
+
+// Deprecate retires the flag name old in favor of the flag replacement. See
+// the top-level Deprecate.
+func (l *Loader) Deprecate(old, replacement, message string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.loaded {
+		panic(fmt.Errorf("flags already loaded"))
+	}
+	l.deprecated[old] = deprecation{
+		replacement: replacement, message: message}
+}
+
+// IsDeprecated returns true if the flag name is deprecated.
+func (l *Loader) IsDeprecated(flag_name string) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.isDeprecated(flag_name)
+}
+
+func (l *Loader) isDeprecated(flag_name string) bool {
+	_, ok := l.deprecated[flag_name]
+	return ok
+}
+
+func (l *Loader) defineDeprecated() error {
+	names := make([]string, 0, len(l.deprecated))
+	for old := range l.deprecated {
+		names = append(names, old)
+	}
+	sort.Strings(names)
+	for _, old := range names {
+		dep := l.deprecated[old]
+		replacement := l.fs.Lookup(dep.replacement)
+		if replacement == nil {
+			return &DefinitionError{Name: old, Err: fmt.Errorf(
+				"deprecated in favor of a non-existent flag %#v",
+				dep.replacement)}
+		}
+		if l.fs.Lookup(old) != nil {
+			return &DefinitionError{Name: old, Err: fmt.Errorf(
+				"deprecated but still defined")}
+		}
+		l.fs.Var(replacement.Value, old, fmt.Sprintf(
+			"deprecated, use -%s instead", dep.replacement))
+	}
+	return nil
+}
+
+// checkDeprecated warns about, or with StrictDeprecations fails on, every
+// use of a deprecated name in the given source results, even those
+// overridden by a higher precedence source or by the replacement itself.
+func (l *Loader) checkDeprecated(results []map[string]Entry) error {
+	names := make([]string, 0, len(l.deprecated))
+	for name := range l.deprecated {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, entries := range results {
+		src := l.sources[i]
+		if _, ok := src.(*defaultSource); ok {
+			continue
+		}
+		for _, name := range names {
+			entry, ok := entries[name]
+			if !ok {
+				continue
+			}
+			dep := l.deprecated[name]
+			_, both := entries[dep.replacement]
+			if _, ok := src.(*commandLineSource); ok && both {
+				// both names were parsed into the same Value, so the
+				// replacement's value is already lost
+				return &AliasConflictError{Name: dep.replacement,
+					Aliases: []string{dep.replacement, name}}
+			}
+			if l.cfg.strictDeprecations {
+				return &DeprecatedFlagError{Name: name,
+					Replacement: dep.replacement, Message: dep.message,
+					Path: entry.Path, Line: entry.Line}
+			}
+			log.Printf("flag %#v (set by %s) is deprecated, use %#v "+
+				"instead: %s", name, provenance(src, entry),
+				dep.replacement, dep.message)
+		}
+	}
+	return nil
+}
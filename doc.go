@@ -24,10 +24,12 @@ flagfile provides the following additional config options:
 
 	--flagfile: a comma-separated list of paths to load
 	--flagout: writes all configured flag settings to this path after load
+	--flagprofile: selects which profile sections of flagfiles to use
 
 Precedence
 
 A flag set on the command line has the highest precedence.
+A flag set in an environment variable (see EnvPrefix) has the next highest.
 A flag set in a flagfile has the next highest.
 The default value has the lowest.
 
@@ -54,6 +56,33 @@ If a section is specified in square braces, all of the following flags up until
 the next section are effectively prefixed with the section name followed by a
 period.
 
+Section headers may also carry conditions, such as `[server @env=prod]`, in
+which case the section's flags are only used if the conditions match the
+facts given with the Facts option (the hostname, GOOS and GOARCH are always
+known as host, goos and goarch).
+
+Sections whose header starts with a profile, such as `[profile:prod]` or
+`[profile:prod server]`, are only used when that profile is selected with the
+--flagprofile flag or the Profile option, and their values override the rest
+of the flagfiles.
+
+A value of the form `@file:path` is replaced by the contents of the file at
+path, minus any trailing newline, and the flag is marked as secret (see
+Secret) so its value is never written out or shown:
+
+	db.password = @file:/run/secrets/db
+
+A flagfile can pull in other flagfiles. A line of the form
+`include = path` loads the flagfiles matching path, which may be a glob
+pattern and is relative to the including flagfile's directory. Matching
+flagfiles are loaded in sorted order, after the including flagfile, so their
+values take precedence. Example:
+
+	include = conf.d/*.conf
+
+A `flagfile = path` line works the same way, except path is relative to the
+working directory and isn't expanded.
+
 See github.com/spacemonkeygo/flagfile/parser for more information on the file
 format.
 */
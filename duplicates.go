@@ -0,0 +1,62 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"log"
+)
+
+// DuplicatePolicy says what Load does when the same flag is set more than
+// once in its flagfiles, whether in the same flagfile or in different ones.
+// A value from a profile section overriding one from outside of any profile
+// section isn't a duplicate.
+type DuplicatePolicy int
+
+const (
+	// LastWins uses the value that was read last.
+	LastWins DuplicatePolicy = iota
+	// FirstWins uses the value that was read first.
+	FirstWins
+	// WarnDuplicates logs a warning and uses the value that was read last.
+	WarnDuplicates
+	// RejectDuplicates makes Load fail with a *DuplicateFlagError.
+	RejectDuplicates
+)
+
+// Duplicates tells Load what to do when the same flag is set more than once
+// in its flagfiles. The default is LastWins.
+func Duplicates(policy DuplicatePolicy) Option {
+	return Option{duplicates: policy, setDuplicates: true}
+}
+
+// resolve returns which of two entries for the named flag to use.
+func (p DuplicatePolicy) resolve(flag_name string, first, second Entry) (
+	Entry, error) {
+	switch p {
+	case FirstWins:
+		return first, nil
+	case WarnDuplicates:
+		log.Printf("flag %#v set at both %s and %s, using the latter",
+			flag_name, location(first.Path, first.Line),
+			location(second.Path, second.Line))
+		return second, nil
+	case RejectDuplicates:
+		return Entry{}, &DuplicateFlagError{Name: flag_name,
+			FirstPath: first.Path, FirstLine: first.Line,
+			Path: second.Path, Line: second.Line}
+	default:
+		return second, nil
+	}
+}
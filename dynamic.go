@@ -0,0 +1,230 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IntFlag is an int flag that is safe to read while Reload or Set changes
+// it. See DynamicInt.
+type IntFlag struct {
+	val  int64
+	mtx  sync.Mutex
+	subs []chan int
+}
+
+// DurationFlag is a time.Duration flag that is safe to read while Reload or
+// Set changes it. See DynamicDuration.
+type DurationFlag struct {
+	val  int64
+	mtx  sync.Mutex
+	subs []chan time.Duration
+}
+
+// StringFlag is a string flag that is safe to read while Reload or Set
+// changes it. See DynamicString.
+type StringFlag struct {
+	val  atomic.Value
+	mtx  sync.Mutex
+	subs []chan string
+}
+
+// DynamicInt defines an int flag with the given name, default value and
+// usage on the default flag set. Unlike with flag.Int, the value may be read
+// with Get at any time, even while flags are being reloaded.
+func DynamicInt(name string, value int, usage string) *IntFlag {
+	return CommandLine.DynamicInt(name, value, usage)
+}
+
+// DynamicDuration defines a time.Duration flag like DynamicInt.
+func DynamicDuration(name string, value time.Duration,
+	usage string) *DurationFlag {
+	return CommandLine.DynamicDuration(name, value, usage)
+}
+
+// DynamicString defines a string flag like DynamicInt.
+func DynamicString(name string, value string, usage string) *StringFlag {
+	return CommandLine.DynamicString(name, value, usage)
+}
+
+// DynamicInt defines an int flag on the Loader's flag set. See the top-level
+// DynamicInt.
+func (l *Loader) DynamicInt(name string, value int, usage string) *IntFlag {
+	f := &IntFlag{val: int64(value)}
+	l.fs.Var((*intValue)(f), name, usage)
+	return f
+}
+
+// DynamicDuration defines a time.Duration flag on the Loader's flag set. See
+// the top-level DynamicInt.
+func (l *Loader) DynamicDuration(name string, value time.Duration,
+	usage string) *DurationFlag {
+	f := &DurationFlag{val: int64(value)}
+	l.fs.Var((*durationValue)(f), name, usage)
+	return f
+}
+
+// DynamicString defines a string flag on the Loader's flag set. See the
+// top-level DynamicInt.
+func (l *Loader) DynamicString(name string, value string,
+	usage string) *StringFlag {
+	f := &StringFlag{}
+	f.val.Store(value)
+	l.fs.Var((*stringValue)(f), name, usage)
+	return f
+}
+
+// Get returns the flag's current value.
+func (f *IntFlag) Get() int { return int(atomic.LoadInt64(&f.val)) }
+
+// Subscribe returns a channel that receives the flag's value whenever it
+// changes. Only the latest value is kept for slow receivers.
+func (f *IntFlag) Subscribe() <-chan int {
+	ch := make(chan int, 1)
+	f.mtx.Lock()
+	f.subs = append(f.subs, ch)
+	f.mtx.Unlock()
+	return ch
+}
+
+// Get returns the flag's current value.
+func (f *DurationFlag) Get() time.Duration {
+	return time.Duration(atomic.LoadInt64(&f.val))
+}
+
+// Subscribe returns a channel that receives the flag's value whenever it
+// changes. Only the latest value is kept for slow receivers.
+func (f *DurationFlag) Subscribe() <-chan time.Duration {
+	ch := make(chan time.Duration, 1)
+	f.mtx.Lock()
+	f.subs = append(f.subs, ch)
+	f.mtx.Unlock()
+	return ch
+}
+
+// Get returns the flag's current value.
+func (f *StringFlag) Get() string {
+	// the zero StringFlag has nothing stored yet
+	s, _ := f.val.Load().(string)
+	return s
+}
+
+// Subscribe returns a channel that receives the flag's value whenever it
+// changes. Only the latest value is kept for slow receivers.
+func (f *StringFlag) Subscribe() <-chan string {
+	ch := make(chan string, 1)
+	f.mtx.Lock()
+	f.subs = append(f.subs, ch)
+	f.mtx.Unlock()
+	return ch
+}
+
+// errParse and errRange are returned instead of the strconv and time errors,
+// which would repeat the possibly secret value.
+var (
+	errParse = errors.New("parse error")
+	errRange = errors.New("value out of range")
+)
+
+// intValue, durationValue and stringValue are the flag.Values of the dynamic
+// flags, which set the value and notify subscribers.
+type (
+	intValue      IntFlag
+	durationValue DurationFlag
+	stringValue   StringFlag
+)
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.ParseInt(s, 0, strconv.IntSize)
+	if err != nil {
+		if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+			return errRange
+		}
+		return errParse
+	}
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	if atomic.SwapInt64(&v.val, n) == n {
+		return nil
+	}
+	for _, ch := range v.subs {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- int(n)
+	}
+	return nil
+}
+
+func (v *intValue) Get() interface{} { return (*IntFlag)(v).Get() }
+
+func (v *intValue) String() string {
+	return strconv.Itoa((*IntFlag)(v).Get())
+}
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return errParse
+	}
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	if atomic.SwapInt64(&v.val, int64(d)) == int64(d) {
+		return nil
+	}
+	for _, ch := range v.subs {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- d
+	}
+	return nil
+}
+
+func (v *durationValue) Get() interface{} {
+	return (*DurationFlag)(v).Get()
+}
+
+func (v *durationValue) String() string {
+	return (*DurationFlag)(v).Get().String()
+}
+
+func (v *stringValue) Set(s string) error {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	if (*StringFlag)(v).Get() == s {
+		return nil
+	}
+	v.val.Store(s)
+	for _, ch := range v.subs {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- s
+	}
+	return nil
+}
+
+func (v *stringValue) Get() interface{} { return (*StringFlag)(v).Get() }
+
+func (v *stringValue) String() string { return (*StringFlag)(v).Get() }
@@ -0,0 +1,44 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"strings"
+)
+
+// EnvPrefix tells Load to also look for flag values in environment
+// variables named with the given prefix. See EnvName for how flag names map
+// to environment variable names. Environment variables override flagfiles
+// but not the command line, unless FlagfilesOverrideEnv is also given. The
+// flagfile, flagout and flagprofile flags can't be set from the environment.
+func EnvPrefix(prefix string) Option {
+	return Option{envPrefix: prefix, useEnv: true}
+}
+
+// FlagfilesOverrideEnv tells Load that values from flagfiles should take
+// precedence over values from environment variables.
+func FlagfilesOverrideEnv() Option {
+	return Option{flagfilesOverrideEnv: true}
+}
+
+var envReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// EnvName returns the environment variable EnvPrefix will check for the given
+// flag. The flag name is upper-cased, has its periods and dashes replaced by
+// underscores, and is prefixed with prefix, so with the prefix "MYAPP_" the
+// flag server.timeout is read from MYAPP_SERVER_TIMEOUT.
+func EnvName(prefix, flag_name string) string {
+	return prefix + strings.ToUpper(envReplacer.Replace(flag_name))
+}
@@ -0,0 +1,275 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// location formats a path and an optional line number.
+func location(path string, line int) string {
+	if line > 0 {
+		return fmt.Sprintf("%s:%d", path, line)
+	}
+	return path
+}
+
+// inPath prefixes msg with the location it concerns, if there is one.
+func inPath(path string, line int, msg string) string {
+	if path == "" {
+		return msg
+	}
+	return fmt.Sprintf("'%s': %s", location(path, line), msg)
+}
+
+// OpenError is returned by LoadE when a flagfile can't be opened.
+type OpenError struct {
+	Path string
+	Err  error
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("unable to open flagfile '%s': %s", e.Path, e.Err)
+}
+
+// ParseError is returned by LoadE when a flagfile can't be parsed.
+type ParseError struct {
+	Path string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return inPath(e.Path, 0, e.Err.Error())
+}
+
+// UnknownFlagError is returned by LoadE when a flagfile or the command line
+// sets a flag that hasn't been defined. Suggestions lists the closest defined
+// flags, or if there are none, the closest sections as "[section]".
+type UnknownFlagError struct {
+	Name        string
+	Path        string
+	Line        int
+	Suggestions []string
+}
+
+func (e *UnknownFlagError) Error() string {
+	msg := fmt.Sprintf("flag %#v doesn't exist", e.Name)
+	if len(e.Suggestions) > 0 {
+		msg += fmt.Sprintf(", did you mean %s?",
+			strings.Join(e.Suggestions, " or "))
+	}
+	return inPath(e.Path, e.Line, msg)
+}
+
+// ValueError is returned by LoadE when a flag rejects the value it was given.
+type ValueError struct {
+	Name  string
+	Value string
+	Path  string
+	Line  int
+	Err   error
+}
+
+func (e *ValueError) Error() string {
+	return inPath(e.Path, e.Line, fmt.Sprintf("unable to set flag %#v to %#v: %s",
+		e.Name, e.Value, e.Err))
+}
+
+// DefinitionError is returned by LoadE when the flags themselves were set up
+// wrong, such as with an alias for a flag that doesn't exist, or when flags
+// were already loaded.
+type DefinitionError struct {
+	Name string
+	Err  error
+}
+
+func (e *DefinitionError) Error() string {
+	if e.Name == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("flag %#v: %s", e.Name, e.Err)
+}
+
+// AliasConflictError is returned by LoadE when more than one name of an
+// aliased flag was set.
+type AliasConflictError struct {
+	Name    string
+	Aliases []string
+}
+
+func (e *AliasConflictError) Error() string {
+	return fmt.Sprintf("multiple aliases of flag %#v set: %v", e.Name, e.Aliases)
+}
+
+// IncludeCycleError is returned by LoadE when flagfiles chain or include each
+// other in a cycle. Chain lists the flagfiles in the cycle, starting and
+// ending with the same one.
+type IncludeCycleError struct {
+	Chain []string
+}
+
+func (e *IncludeCycleError) Error() string {
+	return fmt.Sprintf("flagfile include cycle: %s",
+		strings.Join(e.Chain, " -> "))
+}
+
+// IncludeLimitError is returned by LoadE when flagfiles are chained or
+// included deeper than MaxIncludeDepth, or when more than MaxFlagfiles
+// flagfiles would be read. Chain lists the flagfiles that led to the one
+// that went over the limit.
+type IncludeLimitError struct {
+	Chain []string
+	Limit string
+	Max   int
+}
+
+func (e *IncludeLimitError) Error() string {
+	return fmt.Sprintf("flagfile %s limit of %d exceeded: %s",
+		e.Limit, e.Max, strings.Join(e.Chain, " -> "))
+}
+
+// InterpolationError is returned by LoadE when a reference in a flagfile
+// value can't be expanded, such as when flag references form a cycle.
+type InterpolationError struct {
+	Name string
+	Path string
+	Line int
+	Err  error
+}
+
+func (e *InterpolationError) Error() string {
+	return inPath(e.Path, e.Line, fmt.Sprintf("unable to expand flag %#v: %s",
+		e.Name, e.Err))
+}
+
+// SecretError is returned by LoadE when the file named by a value of the
+// form @file:path can't be read.
+type SecretError struct {
+	Name string
+	Path string
+	Line int
+	Err  error
+}
+
+func (e *SecretError) Error() string {
+	return inPath(e.Path, e.Line, fmt.Sprintf(
+		"unable to read secret value for flag %#v: %s", e.Name, e.Err))
+}
+
+// DuplicateFlagError is returned by LoadE when a flag is set more than once
+// in flagfiles and the RejectDuplicates policy is in effect.
+type DuplicateFlagError struct {
+	Name      string
+	FirstPath string
+	FirstLine int
+	Path      string
+	Line      int
+}
+
+func (e *DuplicateFlagError) Error() string {
+	return fmt.Sprintf("flag %#v set at both %s and %s", e.Name,
+		location(e.FirstPath, e.FirstLine), location(e.Path, e.Line))
+}
+
+// DeprecatedFlagError is returned by LoadE when a deprecated flag name is
+// used and StrictDeprecations is in effect.
+type DeprecatedFlagError struct {
+	Name        string
+	Replacement string
+	Message     string
+	Path        string
+	Line        int
+}
+
+func (e *DeprecatedFlagError) Error() string {
+	return inPath(e.Path, e.Line, fmt.Sprintf(
+		"flag %#v is deprecated, use %#v instead: %s",
+		e.Name, e.Replacement, e.Message))
+}
+
+// MissingFlagsError is returned by LoadE when required flags weren't set.
+type MissingFlagsError struct {
+	Names []string
+}
+
+func (e *MissingFlagsError) Error() string {
+	return fmt.Sprintf("missing required flags: %s",
+		strings.Join(e.Names, ", "))
+}
+
+// ValidationError describes a flag value that failed one of its checks.
+type ValidationError struct {
+	Name   string
+	Value  string
+	Origin Provenance
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid value %#v for flag %#v (from %s): %s",
+		e.Value, e.Name, e.Origin, e.Err)
+}
+
+// ValidationErrors is returned by LoadE when flag values fail their checks.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// ConstraintError describes a violated constraint between flags, such as one
+// declared by MutuallyExclusive. Set is the constrained flags that were set.
+type ConstraintError struct {
+	Kind  ConstraintKind
+	Names []string
+	Set   []string
+}
+
+func (e *ConstraintError) Error() string {
+	set := "none"
+	if len(e.Set) > 0 {
+		set = strings.Join(e.Set, ", ")
+	}
+	return fmt.Sprintf("%s, but set flags were: %s",
+		constraint{kind: e.Kind, names: e.Names}, set)
+}
+
+// ConstraintErrors is returned by LoadE when constraints between flags are
+// violated.
+type ConstraintErrors []*ConstraintError
+
+func (e ConstraintErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// FrozenFlagError is returned when setting a flag directly after Load with
+// Freeze.
+type FrozenFlagError struct {
+	Name string
+}
+
+func (e *FrozenFlagError) Error() string {
+	return fmt.Sprintf("flag %#v is frozen, use flagfile.Set to change it",
+		e.Name)
+}
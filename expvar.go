@@ -0,0 +1,54 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+
+	"github.com/spacemonkeygo/flagfile/parser"
+)
+
+// PublishExpvar publishes the current flag values as the expvar called name.
+// See Loader.PublishExpvar.
+func PublishExpvar(name string) {
+	CommandLine.PublishExpvar(name)
+}
+
+// PublishExpvar publishes the Loader's current flag values, as written by
+// Dump, as the expvar called name, and a SHA-256 hash of them as the expvar
+// called name + ".hash", so that hosts whose configuration differs are easy
+// to spot. Like expvar.Publish, it panics if either name is already taken.
+func (l *Loader) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		l.mtx.Lock()
+		defer l.mtx.Unlock()
+		return l.dumpValues(false, false)
+	}))
+	expvar.Publish(name+".hash", expvar.Func(func() interface{} {
+		l.mtx.Lock()
+		vals := l.dumpValues(false, false)
+		l.mtx.Unlock()
+		var buf bytes.Buffer
+		err := parser.Serialize(vals, &buf)
+		if err != nil {
+			return err.Error()
+		}
+		sum := sha256.Sum256(buf.Bytes())
+		return hex.EncodeToString(sum[:])
+	}))
+}
@@ -0,0 +1,39 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"os"
+	"runtime"
+)
+
+// Facts tells Load about facts that conditional flagfile sections, such as
+// [server @env=prod], are matched against. The facts host, goos and goarch
+// are filled in automatically from the hostname, runtime.GOOS and
+// runtime.GOARCH, but can be overridden. See parser.Parser for the syntax.
+func Facts(facts map[string]string) Option {
+	return Option{facts: facts}
+}
+
+func defaultFacts() map[string]string {
+	facts := map[string]string{
+		"goos":   runtime.GOOS,
+		"goarch": runtime.GOARCH,
+	}
+	if host, err := os.Hostname(); err == nil {
+		facts["host"] = host
+	}
+	return facts
+}
@@ -0,0 +1,175 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spacemonkeygo/flagfile/parser"
+)
+
+// setting is a single flag assignment read from a flagfile.
+type setting struct {
+	name    string
+	value   string
+	path    string
+	line    int
+	profile string
+}
+
+// includePaths resolves the value of an include directive found in the
+// flagfile at path. Relative patterns are relative to the flagfile's
+// directory, and glob patterns expand to every matching path, sorted. If the
+// value is a glob pattern, it's returned resolved as glob.
+func includePaths(path, pattern string) (paths []string, glob string,
+	err error) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(path), pattern)
+	}
+	if !strings.ContainsAny(pattern, "*?[\\") {
+		return []string{pattern}, "", nil
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Strings(matches)
+	return matches, pattern, nil
+}
+
+const (
+	defaultMaxIncludeDepth = 32
+	defaultMaxFlagfiles    = 1024
+)
+
+// MaxIncludeDepth tells Load to fail if flagfiles are chained or included
+// more than depth levels deep. The default is 32.
+func MaxIncludeDepth(depth int) Option {
+	return Option{maxIncludeDepth: depth}
+}
+
+// MaxFlagfiles tells Load to fail if more than count flagfiles would be read.
+// The default is 1024.
+func MaxFlagfiles(count int) Option {
+	return Option{maxFlagfiles: count}
+}
+
+// queuedFlagfile is a flagfile waiting to be read, along with the chain of
+// flagfiles that led to it, itself included.
+type queuedFlagfile struct {
+	path  string
+	chain []string
+}
+
+func (q queuedFlagfile) then(paths ...string) (queued []queuedFlagfile) {
+	for _, path := range paths {
+		chain := append(append([]string(nil), q.chain...), path)
+		queued = append(queued, queuedFlagfile{path: path, chain: chain})
+	}
+	return queued
+}
+
+// inChain returns whether the flagfile at path is already in chain.
+func inChain(chain []string, path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	for _, other := range chain {
+		other_abs, err := filepath.Abs(other)
+		if err != nil {
+			other_abs = other
+		}
+		if other_abs == abs {
+			return true
+		}
+	}
+	return false
+}
+
+// readFlagfiles parses the given flagfiles, following flagfile chaining and
+// include directives. It returns every setting found, in order, along with
+// the paths of all of the flagfiles that were read and every glob pattern
+// that was included, so that new matches can be watched for.
+//
+// Chained and included flagfiles are read after the flagfiles before them in
+// the queue, so their settings take precedence. Chained flagfiles (a
+// "flagfile" key) are relative to the working directory, as they would be on
+// the command line, while included flagfiles (an "include" key) are relative
+// to the flagfile that includes them.
+func readFlagfiles(flagfiles []string, cfg *config, profile string) (
+	settings []setting, paths, globs []string, err error) {
+	p := &parser.Parser{Facts: cfg.facts, Profile: profile}
+	max_depth, max_files := cfg.maxIncludeDepth, cfg.maxFlagfiles
+	queue := queuedFlagfile{}.then(flagfiles...)
+	for len(queue) > 0 {
+		q := queue[0]
+		queue = queue[1:]
+		file := q.path
+		if len(file) == 0 {
+			continue
+		}
+		if inChain(q.chain[:len(q.chain)-1], file) {
+			return nil, nil, nil, &IncludeCycleError{Chain: q.chain}
+		}
+		if max_depth > 0 && len(q.chain) > max_depth {
+			return nil, nil, nil, &IncludeLimitError{
+				Chain: q.chain, Limit: "depth", Max: max_depth}
+		}
+		if max_files > 0 && len(paths) >= max_files {
+			return nil, nil, nil, &IncludeLimitError{
+				Chain: q.chain, Limit: "flagfile count", Max: max_files}
+		}
+		fh, err := os.Open(file)
+		if err != nil {
+			return nil, nil, nil, &OpenError{Path: file, Err: err}
+		}
+		paths = append(paths, file)
+		var include_err error
+		err = p.ParseSettings(fh, func(s parser.Setting) {
+			switch s.Key {
+			case "flagfile":
+				// allow flagfile chaining
+				queue = append(queue, q.then(s.Value)...)
+			case "include":
+				included, glob, err := includePaths(file, s.Value)
+				if err != nil && include_err == nil {
+					include_err = fmt.Errorf("bad include on line %d: %s",
+						s.Line, err)
+				}
+				if glob != "" {
+					globs = append(globs, glob)
+				}
+				queue = append(queue, q.then(included...)...)
+			default:
+				settings = append(settings, setting{name: s.Key,
+					value: s.Value, path: file, line: s.Line,
+					profile: s.Profile})
+			}
+		})
+		fh.Close()
+		if err == nil {
+			err = include_err
+		}
+		if err != nil {
+			return nil, nil, nil, &ParseError{Path: file, Err: err}
+		}
+	}
+	return settings, paths, globs, nil
+}
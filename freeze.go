@@ -0,0 +1,198 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// Freeze tells Load to wrap the Value of every flag once flags are loaded,
+// so that setting a flag directly, such as with flag.Set, fails with a
+// *FrozenFlagError. Flags can then only be changed by Reload and Set.
+func Freeze() Option {
+	return Option{freeze: true}
+}
+
+// frozenValue rejects Set unless the Loader thawed it.
+type frozenValue struct {
+	flag.Value
+	name   string
+	thawed int32
+}
+
+func (v *frozenValue) Set(s string) error {
+	if atomic.LoadInt32(&v.thawed) == 0 {
+		return &FrozenFlagError{Name: v.name}
+	}
+	return v.Value.Set(s)
+}
+
+func (v *frozenValue) Get() interface{} {
+	if g, ok := v.Value.(flag.Getter); ok {
+		return g.Get()
+	}
+	return v.Value.String()
+}
+
+func (v *frozenValue) IsBoolFlag() bool {
+	b, ok := v.Value.(interface {
+		IsBoolFlag() bool
+	})
+	return ok && b.IsBoolFlag()
+}
+
+func (l *Loader) freeze() {
+	l.fs.VisitAll(func(f *flag.Flag) {
+		f.Value = &frozenValue{Value: f.Value, name: f.Name}
+	})
+}
+
+// AuditRecord describes a change made by Set.
+type AuditRecord struct {
+	Name string
+	// Old and New are the flag's values before and after, redacted if the
+	// flag is secret.
+	Old string
+	New string
+	// Who is the function that called Set, or whoever made the change
+	// through Handler.
+	Who    string
+	Reason string
+	When   time.Time
+}
+
+// Set changes the value of the named flag at runtime and records the change
+// in the audit log. See Loader.Set.
+func Set(flag_name, value, reason string) error {
+	return CommandLine.set(flag_name, value, callerName(2), reason)
+}
+
+// AuditLog returns every change made by Set, oldest first.
+func AuditLog() []AuditRecord {
+	return CommandLine.AuditLog()
+}
+
+// Set changes the value of the named flag once flags are loaded, and records
+// who changed it, when and why in the audit log. The new value must pass the
+// flag's checks (see Validate), and OnChange callbacks are called as with
+// Reload. A later Reload only replaces the value if the flag's value in its
+// sources changed.
+func (l *Loader) Set(flag_name, value, reason string) error {
+	return l.set(flag_name, value, callerName(2), reason)
+}
+
+// AuditLog returns every change made by Set, oldest first.
+func (l *Loader) AuditLog() []AuditRecord {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return append([]AuditRecord(nil), l.audit...)
+}
+
+// callerName returns the name of the function skip frames up the stack.
+func callerName(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip)
+	if !ok {
+		return "unknown"
+	}
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return "unknown"
+	}
+	return fn.Name()
+}
+
+// runtimeSource is the Source of values changed by Set.
+type runtimeSource struct{}
+
+func (s *runtimeSource) Name() string { return "runtime" }
+
+func (s *runtimeSource) Load(ctx context.Context) (map[string]Entry, error) {
+	return nil, nil
+}
+
+func (l *Loader) set(flag_name, val, who, reason string) error {
+	l.mtx.Lock()
+	if !l.loaded {
+		l.mtx.Unlock()
+		return fmt.Errorf("flags not loaded")
+	}
+	if dep, ok := l.deprecated[flag_name]; ok {
+		flag_name = dep.replacement
+	}
+	f := l.fs.Lookup(flag_name)
+	if f == nil {
+		l.mtx.Unlock()
+		return l.unknownFlag(flag_name, "", 0)
+	}
+	old := f.Value.String()
+	candidates, err := l.candidates([]string{flag_name},
+		map[string]Entry{flag_name: {Value: val}})
+	if err != nil {
+		l.mtx.Unlock()
+		return err
+	}
+	prev, had_prev := l.values[flag_name]
+	restore := func() {
+		if had_prev {
+			l.values[flag_name] = prev
+		} else {
+			delete(l.values, flag_name)
+		}
+	}
+	// overrode[0] is always the value from the flag's sources, for
+	// keepRuntime
+	overrode := []Provenance{l.unredactedOrigin(flag_name)}
+	if _, ok := prev.source.(*runtimeSource); had_prev && ok {
+		overrode = prev.overrode
+	}
+	l.values[flag_name] = value{entry: Entry{Value: val},
+		source: &runtimeSource{}, overrode: overrode}
+	err = l.validate(candidates)
+	if err == nil {
+		err = l.setFlag(flag_name, Entry{Value: val})
+	}
+	if err != nil {
+		restore()
+		l.mtx.Unlock()
+		return err
+	}
+	l.set_flags[flag_name] = true
+	l.audit = append(l.audit, AuditRecord{Name: flag_name,
+		Old: l.redact(flag_name, old),
+		New: l.redact(flag_name, f.Value.String()),
+		Who: who, Reason: reason, When: time.Now()})
+	l.mtx.Unlock()
+	l.notify([]change{{name: flag_name, old: old, new: f.Value.String()}})
+	return nil
+}
+
+// keepRuntime keeps the values changed by Set in the given newly loaded
+// values, unless the value from the flag's sources changed since.
+func (l *Loader) keepRuntime(values map[string]value) {
+	for name, old := range l.values {
+		if _, ok := old.source.(*runtimeSource); !ok {
+			continue
+		}
+		val, ok := values[name]
+		if ok && val.entry.Value == old.overrode[0].Value {
+			values[name] = old
+		}
+	}
+}
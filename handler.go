@@ -0,0 +1,211 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"encoding/json"
+	"flag"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// HandlerOption changes how Handler behaves.
+type HandlerOption struct {
+	authenticate func(r *http.Request) (who string, ok bool)
+}
+
+// Authenticate tells Handler how to authenticate requests that change
+// flags. fn returns who made the request, which is recorded in the audit
+// log, and whether they are allowed to change flags. Without this option,
+// Handler doesn't allow any changes.
+func Authenticate(
+	fn func(r *http.Request) (who string, ok bool)) HandlerOption {
+	return HandlerOption{authenticate: fn}
+}
+
+// Mutable marks the named flags as changeable at runtime through Handler.
+func Mutable(flag_names ...string) {
+	CommandLine.Mutable(flag_names...)
+}
+
+// Handler returns an http.Handler for inspecting and changing flags. See
+// Loader.Handler.
+func Handler(opts ...HandlerOption) http.Handler {
+	return CommandLine.Handler(opts...)
+}
+
+// Mutable marks the named flags as changeable at runtime through Handler.
+func (l *Loader) Mutable(flag_names ...string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	for _, flag_name := range flag_names {
+		l.mutable[flag_name] = true
+	}
+}
+
+func (l *Loader) isMutable(flag_name string) bool {
+	for _, name := range l.aliasGroup(flag_name) {
+		if l.mutable[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler returns an http.Handler that lists every flag with its value,
+// default, usage and origin, as JSON if the request asks for it with
+// ?format=json or its Accept header, or as HTML otherwise. Secret flags are
+// redacted.
+//
+// POSTing a form with name, value and reason fields changes the named flag
+// with Set, recording who the Authenticate option says made the request.
+// Only flags marked with Mutable can be changed, and the response is the
+// changed flag as JSON.
+func (l *Loader) Handler(opts ...HandlerOption) http.Handler {
+	var h flagHandler
+	h.l = l
+	for _, opt := range opts {
+		if opt.authenticate != nil {
+			h.authenticate = opt.authenticate
+		}
+	}
+	return &h
+}
+
+type flagHandler struct {
+	l            *Loader
+	authenticate func(r *http.Request) (who string, ok bool)
+}
+
+// flagInfo describes a flag for Handler.
+type flagInfo struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+	Origin  string `json:"origin"`
+	Alias   bool   `json:"alias"`
+	Secret  bool   `json:"secret"`
+	Mutable bool   `json:"mutable"`
+}
+
+func (l *Loader) flagInfo(f *flag.Flag) flagInfo {
+	return flagInfo{
+		Name:    f.Name,
+		Value:   l.redact(f.Name, f.Value.String()),
+		Default: l.redact(f.Name, f.DefValue),
+		Usage:   f.Usage,
+		Origin:  l.origin(f.Name).String(),
+		Alias:   l.isAlias(f.Name),
+		Secret:  l.isSecret(f.Name),
+		Mutable: l.isMutable(f.Name),
+	}
+}
+
+func (h *flagHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+		h.list(w, r)
+	case "POST":
+		h.change(w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *flagHandler) list(w http.ResponseWriter, r *http.Request) {
+	var flags []flagInfo
+	h.l.mtx.Lock()
+	h.l.fs.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, h.l.flagInfo(f))
+	})
+	h.l.mtx.Unlock()
+
+	if r.FormValue("format") == "json" ||
+		strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeJSON(w, http.StatusOK, flags)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := flagsTemplate.Execute(w, flags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *flagHandler) change(w http.ResponseWriter, r *http.Request) {
+	if h.authenticate == nil {
+		http.Error(w, "changing flags is disabled", http.StatusForbidden)
+		return
+	}
+	who, ok := h.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	name := r.FormValue("name")
+	h.l.mtx.Lock()
+	f := h.l.fs.Lookup(name)
+	mutable := f != nil && h.l.isMutable(name)
+	h.l.mtx.Unlock()
+	if f == nil {
+		http.Error(w, "unknown flag", http.StatusNotFound)
+		return
+	}
+	if !mutable {
+		http.Error(w, "flag is not mutable", http.StatusForbidden)
+		return
+	}
+	err := h.l.set(name, r.FormValue("value"), who, r.FormValue("reason"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.l.mtx.Lock()
+	info := h.l.flagInfo(f)
+	h.l.mtx.Unlock()
+	writeJSON(w, http.StatusOK, info)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+var flagsTemplate = template.Must(template.New("flags").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Flags</title></head>
+<body>
+<table>
+<tr><th>Name</th><th>Value</th><th>Default</th><th>Origin</th><th>Usage</th></tr>
+{{range .}}<tr>
+<td>{{.Name}}{{if .Alias}} (alias){{end}}{{if .Mutable}} (mutable){{end}}</td>
+<td>{{.Value}}</td>
+<td>{{.Default}}</td>
+<td>{{.Origin}}</td>
+<td>{{.Usage}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,95 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile_test
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/spacemonkeygo/flagfile"
+)
+
+func TestHandler(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	workers := fs.Int("workers", 1, "how many workers")
+	fs.String("password", "hunter2", "")
+	l := flagfile.NewLoader(fs)
+	l.Secret("password")
+	l.Mutable("workers")
+	err := l.LoadE(flagfile.SkipArgs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(l.Handler(flagfile.Authenticate(
+		func(r *http.Request) (string, bool) {
+			user, pass, ok := r.BasicAuth()
+			return user, ok && pass == "secret"
+		})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?format=json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flags []struct {
+		Name  string
+		Value string
+	}
+	err = json.NewDecoder(resp.Body).Decode(&flags)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range flags {
+		if f.Name == "password" && f.Value != "<redacted>" {
+			t.Fatalf("secret not redacted: %#v", f.Value)
+		}
+	}
+
+	post := func(name, pass string) int {
+		form := url.Values{"name": {name}, "value": {"4"}, "reason": {"load"}}
+		req, err := http.NewRequest("POST", srv.URL,
+			strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("alice", pass)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post("workers", "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated post returned %d", code)
+	}
+	if code := post("password", "secret"); code != http.StatusForbidden {
+		t.Fatalf("post to immutable flag returned %d", code)
+	}
+	if code := post("workers", "secret"); code != http.StatusOK {
+		t.Fatalf("post returned %d", code)
+	}
+	log := l.AuditLog()
+	if *workers != 4 || len(log) != 1 || log[0].Who != "alice" {
+		t.Fatalf("unexpected audit log: %v", log)
+	}
+}
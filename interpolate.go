@@ -0,0 +1,141 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spacemonkeygo/flagfile/parser"
+)
+
+// Interpolate tells Load to expand references in values from flagfiles.
+// ${env:NAME} expands to the environment variable NAME, ${flag:name} to the
+// final value of the flag name (after its own references are expanded), and
+// ${name} to the fact name (see Facts). $$ is an escaped $.
+func Interpolate() Option {
+	return Option{interpolate: true}
+}
+
+// interpolator expands the references in a set of merged values.
+type interpolator struct {
+	l        *Loader
+	values   map[string]value
+	expanded map[string]bool
+	visiting []string
+}
+
+// interpolate expands the references in every value from a flagfile,
+// resolving flag references in dependency order. The original text of
+// expanded values is kept in their raw field, and values that reference
+// secret flags are marked secret.
+func (l *Loader) interpolate(values map[string]value) error {
+	in := &interpolator{
+		l:        l,
+		values:   values,
+		expanded: make(map[string]bool),
+	}
+	for _, name := range sortedNames(values) {
+		_, err := in.expand(name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in *interpolator) expand(flag_name string) (string, error) {
+	val, ok := in.values[flag_name]
+	if !ok {
+		f := in.l.fs.Lookup(flag_name)
+		if f == nil {
+			return "", fmt.Errorf("flag %#v doesn't exist", flag_name)
+		}
+		return f.Value.String(), nil
+	}
+	// values read from secret files are never expanded
+	if _, ok := val.source.(*flagfileSource); !ok || in.expanded[flag_name] ||
+		val.raw != "" {
+		return val.entry.Value, nil
+	}
+	for i, name := range in.visiting {
+		if name == flag_name {
+			chain := append(append([]string(nil), in.visiting[i:]...),
+				flag_name)
+			return "", &InterpolationError{
+				Name: flag_name, Path: val.entry.Path, Line: val.entry.Line,
+				Err: fmt.Errorf("reference cycle %s",
+					strings.Join(chain, " -> "))}
+		}
+	}
+
+	in.visiting = append(in.visiting, flag_name)
+	expanded, err := parser.Expand(val.entry.Value, in.lookup)
+	in.visiting = in.visiting[:len(in.visiting)-1]
+	if err != nil {
+		if _, ok := err.(*InterpolationError); ok {
+			return "", err
+		}
+		return "", &InterpolationError{Name: flag_name,
+			Path: val.entry.Path, Line: val.entry.Line, Err: err}
+	}
+
+	if expanded != val.entry.Value {
+		val.raw = val.entry.Value
+		val.entry.Value = expanded
+		in.values[flag_name] = val
+	}
+	in.expanded[flag_name] = true
+	return expanded, nil
+}
+
+// resolve returns the name whose value the named flag ends up with: its
+// replacement's if it's deprecated, and the alias it was set through if it
+// wasn't set under its own name.
+func (in *interpolator) resolve(flag_name string) string {
+	if dep, ok := in.l.deprecated[flag_name]; ok {
+		flag_name = dep.replacement
+	}
+	if val, ok := in.values[flag_name]; ok && val.active() {
+		return flag_name
+	}
+	for _, name := range in.l.aliasGroup(flag_name) {
+		if val, ok := in.values[name]; ok && val.active() {
+			return name
+		}
+	}
+	return flag_name
+}
+
+func (in *interpolator) lookup(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		return os.Getenv(strings.TrimPrefix(ref, "env:")), nil
+	case strings.HasPrefix(ref, "flag:"):
+		name := in.resolve(strings.TrimPrefix(ref, "flag:"))
+		val, err := in.expand(name)
+		if err == nil && in.l.isSecret(name) {
+			// whatever references a secret is secret too
+			in.l.secrets[in.visiting[len(in.visiting)-1]] = true
+		}
+		return val, err
+	}
+	fact, ok := in.l.cfg.facts[ref]
+	if !ok {
+		return "", fmt.Errorf("unknown fact %#v", ref)
+	}
+	return fact, nil
+}
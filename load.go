@@ -15,46 +15,156 @@
 package flagfile
 
 import (
-	"flag"
-	"fmt"
 	"os"
-	"strings"
-	"sync"
-
-	"github.com/spacemonkeygo/flagfile/parser"
-)
-
-var (
-	flagfile = flag.String("flagfile", "", "a file (or multiple files, "+
-		"comma-separated) from which to load flags")
-
-	mtx       sync.Mutex
-	loaded    = false
-	set_flags = make(map[string]bool)
+	"time"
 )
 
 // IsActivelySet returns whether or not the user configured the given flag.
-// The value is false if the flag was not set by commandline or flagfile.
+// The value is false if the flag was not set by commandline, environment or
+// flagfile.
 func IsActivelySet(flag_name string) bool {
-	mtx.Lock()
-	defer mtx.Unlock()
-	return set_flags[flag_name]
+	return CommandLine.IsActivelySet(flag_name)
+}
+
+type Option struct {
+	flagfilePath         string
+	skipArgs             bool
+	ignoreUnknowns       bool
+	args                 []string
+	useEnv               bool
+	envPrefix            string
+	flagfilesOverrideEnv bool
+	watchInterval        time.Duration
+	reloadSignals        []os.Signal
+	sources              []Source
+	maxIncludeDepth      int
+	maxFlagfiles         int
+	facts                map[string]string
+	profile              string
+	interpolate          bool
+	freeze               bool
+	interspersed         bool
+	duplicates           DuplicatePolicy
+	strictDeprecations   bool
+	setDuplicates        bool
+	short_usage          func()
+	full_usage           func()
+}
+
+// config is the combination of all of the Options given to Load.
+type config struct {
+	flagfiles            []string
+	skipArgs             bool
+	ignoreUnknowns       bool
+	args                 []string
+	useEnv               bool
+	envPrefix            string
+	flagfilesOverrideEnv bool
+	watchInterval        time.Duration
+	reloadSignals        []os.Signal
+	sources              []Source
+	maxIncludeDepth      int
+	maxFlagfiles         int
+	facts                map[string]string
+	profile              string
+	interpolate          bool
+	freeze               bool
+	interspersed         bool
+	duplicates           DuplicatePolicy
+	strictDeprecations   bool
+	short_usage          func()
+	full_usage           func()
 }
 
-func mustSet(flag_name, flag_value string) {
-	err := flag.Set(flag_name, flag_value)
-	if err != nil {
-		panic(fmt.Errorf("Unable to set flag %#v to %#v: %s",
-			flag_name, flag_value, err))
+func newConfig(l *Loader, opts []Option) *config {
+	cfg := &config{
+		args:            os.Args[1:],
+		maxIncludeDepth: defaultMaxIncludeDepth,
+		maxFlagfiles:    defaultMaxFlagfiles,
+		facts:           defaultFacts(),
+		short_usage:     l.ShortUsage,
+		full_usage:      l.FullUsage,
 	}
+	for _, opt := range opts {
+		if opt.flagfilePath != "" {
+			cfg.flagfiles = append(cfg.flagfiles, opt.flagfilePath)
+		}
+		if opt.skipArgs {
+			cfg.skipArgs = true
+		}
+		if opt.ignoreUnknowns {
+			cfg.ignoreUnknowns = true
+		}
+		if opt.args != nil {
+			cfg.args = opt.args
+		}
+		if opt.useEnv {
+			cfg.useEnv = true
+			cfg.envPrefix = opt.envPrefix
+		}
+		if opt.flagfilesOverrideEnv {
+			cfg.flagfilesOverrideEnv = true
+		}
+		if opt.watchInterval > 0 {
+			cfg.watchInterval = opt.watchInterval
+		}
+		cfg.reloadSignals = append(cfg.reloadSignals, opt.reloadSignals...)
+		if opt.sources != nil {
+			cfg.sources = opt.sources
+		}
+		if opt.maxIncludeDepth != 0 {
+			cfg.maxIncludeDepth = opt.maxIncludeDepth
+		}
+		if opt.maxFlagfiles != 0 {
+			cfg.maxFlagfiles = opt.maxFlagfiles
+		}
+		for fact, val := range opt.facts {
+			cfg.facts[fact] = val
+		}
+		if opt.profile != "" {
+			cfg.profile = opt.profile
+		}
+		if opt.interpolate {
+			cfg.interpolate = true
+		}
+		if opt.freeze {
+			cfg.freeze = true
+		}
+		if opt.interspersed {
+			cfg.interspersed = true
+		}
+		if opt.setDuplicates {
+			cfg.duplicates = opt.duplicates
+		}
+		if opt.strictDeprecations {
+			cfg.strictDeprecations = true
+		}
+		if opt.short_usage != nil {
+			cfg.short_usage = opt.short_usage
+		}
+		if opt.full_usage != nil {
+			cfg.full_usage = opt.full_usage
+		}
+	}
+	return cfg
 }
 
-type Option struct {
-	flagfilePath   string
-	skipArgs       bool
-	ignoreUnknowns bool
-	short_usage    func()
-	full_usage     func()
+// defaultSources returns the sources to use when the Sources option wasn't
+// given.
+func (cfg *config) defaultSources() []Source {
+	var sources []Source
+	if !cfg.skipArgs {
+		sources = append(sources, CommandLineSource())
+	}
+	files := FlagfileSource(cfg.flagfiles...)
+	if cfg.useEnv && cfg.flagfilesOverrideEnv {
+		sources = append(sources, files, EnvSource(cfg.envPrefix))
+	} else if cfg.useEnv {
+		sources = append(sources, EnvSource(cfg.envPrefix), files)
+	} else {
+		sources = append(sources, files)
+	}
+	return append(sources, DefaultSource())
 }
 
 // Flagfile tells Load to find default values from the flagfile at path (which
@@ -79,104 +189,42 @@ func FullUsageFunc(fn func()) Option {
 	return Option{short_usage: fn}
 }
 
+// Profile tells Load which profile sections of flagfiles to use, such as
+// [profile:prod], unless a different one is given with the flagprofile flag.
+// Values from the profile's sections override values from the rest of the
+// flagfiles.
+func Profile(name string) Option {
+	return Option{profile: name}
+}
+
 // IgnoreUnknownFlags tells Load to skip loading values for non-existent flags
 func IgnoreUnknownFlags() Option {
 	return Option{ignoreUnknowns: true}
 }
 
+// Arguments tells Load to parse the given arguments instead of os.Args[1:].
+func Arguments(args []string) Option {
+	if args == nil {
+		args = []string{}
+	}
+	return Option{args: args}
+}
+
 // SkipArgs will tell Load to not call flag.Parse and otherwise avoid looking
 // at process arguments
 func SkipArgs() Option { return Option{skipArgs: true} }
 
 // Load is the flagfile equivalent/replacement for flag.Parse()
-// Call once at program start.
+// Call once at program start. Load panics if the flags can't be loaded; see
+// LoadE for a version that returns an error instead.
 func Load(opts ...Option) {
-	defer flagOut()
-	mtx.Lock()
-	defer mtx.Unlock()
-	if loaded {
-		panic(fmt.Errorf("flags already loaded"))
-	}
-
-	defineAliases()
-
-	var flagfiles []string
-	var skipArgs bool
-	var ignoreUnknowns bool
-	short_usage := ShortUsage
-	full_usage := FullUsage
-	for _, opt := range opts {
-		if opt.flagfilePath != "" {
-			flagfiles = append(flagfiles, opt.flagfilePath)
-		}
-		if opt.skipArgs {
-			skipArgs = true
-		}
-		if opt.ignoreUnknowns {
-			ignoreUnknowns = true
-		}
-		if opt.short_usage != nil {
-			short_usage = opt.short_usage
-		}
-		if opt.full_usage != nil {
-			full_usage = opt.full_usage
-		}
-	}
-
-	cmdline_set_flags := map[string]bool{}
-	if !skipArgs {
-		flag.CommandLine.Usage = short_usage
-		args := os.Args[1:]
-		for _, arg := range args {
-			if arg == "--" {
-				break
-			}
-			if arg == "--help-all" || arg == "-help-all" {
-				full_usage()
-				os.Exit(2)
-			}
-		}
-		flag.CommandLine.Parse(os.Args[1:])
-		flag.Visit(func(f *flag.Flag) {
-			cmdline_set_flags[f.Name] = true
-			set_flags[f.Name] = true
-		})
-	}
-	loaded = true
-
-	flagfiles = append(flagfiles, strings.Split(*flagfile, ",")...)
-
-	for len(flagfiles) > 0 {
-		file := flagfiles[0]
-		flagfiles = flagfiles[1:]
-		if len(file) == 0 {
-			continue
-		}
-		fh, err := os.Open(file)
-		if err != nil {
-			panic(fmt.Errorf("unable to open flagfile '%s': %s", file, err))
-		}
-		err = parser.Parse(fh, func(name, value string) {
-			if name == "flagfile" {
-				// allow flagfile chaining
-				flagfiles = append(flagfiles, value)
-				return
-			}
-			// command line flags override file flags
-			if cmdline_set_flags[name] {
-				return
-			}
-			if ignoreUnknowns && flag.Lookup(name) == nil {
-				return
-			}
-			mustSet(name, value)
-			set_flags[name] = true
-		})
-		fh.Close()
-		if err != nil {
-			panic(fmt.Errorf("'%s': %s", file, err))
-		}
-	}
+	CommandLine.Load(opts...)
+}
 
-	setAliases()
+// LoadE is like Load but returns an error instead of panicking when a
+// flagfile can't be opened or parsed, or sets an unknown flag or a bad value.
+// The error will be one of *OpenError, *ParseError, *UnknownFlagError,
+// *ValueError or *AliasConflictError.
+func LoadE(opts ...Option) error {
+	return CommandLine.LoadE(opts...)
 }
@@ -0,0 +1,945 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile_test
+
+import (
+	"bytes"
+	"context"
+	"expvar"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spacemonkeygo/flagfile"
+)
+
+func writeFlagfile(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte(contents), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "flagfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLoaderPrecedence(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeFlagfile(t, dir, "a.conf", `
+a = 1
+b = 2
+[section]
+c = 3
+`)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	a := fs.Int("a", 0, "")
+	b := fs.Int("b", 0, "")
+	c := fs.Int("section.c", 0, "")
+	d := fs.Int("d", 4, "")
+	l := flagfile.NewLoader(fs)
+	err := l.LoadE(flagfile.Flagfile(path), flagfile.Arguments([]string{"-a=10"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *a != 10 || *b != 2 || *c != 3 || *d != 4 {
+		t.Fatalf("unexpected values: %d %d %d %d", *a, *b, *c, *d)
+	}
+	if !l.IsActivelySet("a") || !l.IsActivelySet("section.c") ||
+		l.IsActivelySet("d") {
+		t.Fatal("unexpected actively set flags")
+	}
+}
+
+func TestLoaderAliases(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	val := fs.String("new", "", "")
+	l := flagfile.NewLoader(fs)
+	l.Alias("old", "new")
+	err := l.LoadE(flagfile.Arguments([]string{"-old=hello"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *val != "hello" || !l.IsAlias("old") || l.IsAlias("new") {
+		t.Fatal("alias not applied")
+	}
+}
+
+func TestLoaderErrors(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	unknown := writeFlagfile(t, dir, "unknown.conf", "missing = 1\n")
+	unparsable := writeFlagfile(t, dir, "unparsable.conf", "n\n")
+	bad := writeFlagfile(t, dir, "bad.conf", "\nn = nope\n")
+	both := writeFlagfile(t, dir, "both.conf", "n = 1\nold-n = 2\n")
+
+	for _, test := range []struct {
+		flagfile string
+		check    func(err error) bool
+	}{
+		{filepath.Join(dir, "nope.conf"), func(err error) bool {
+			_, ok := err.(*flagfile.OpenError)
+			return ok
+		}},
+		{unparsable, func(err error) bool {
+			e, ok := err.(*flagfile.ParseError)
+			return ok && e.Path == unparsable
+		}},
+		{unknown, func(err error) bool {
+			e, ok := err.(*flagfile.UnknownFlagError)
+			return ok && e.Name == "missing" && e.Path == unknown &&
+				e.Line == 1
+		}},
+		{bad, func(err error) bool {
+			e, ok := err.(*flagfile.ValueError)
+			return ok && e.Name == "n" && e.Value == "nope" &&
+				e.Path == bad && e.Line == 2
+		}},
+		{both, func(err error) bool {
+			e, ok := err.(*flagfile.AliasConflictError)
+			return ok && e.Name == "n" && len(e.Aliases) == 2
+		}},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.Int("n", 0, "")
+		l := flagfile.NewLoader(fs)
+		l.Alias("old-n", "n")
+		err := l.LoadE(flagfile.Flagfile(test.flagfile), flagfile.SkipArgs())
+		if !test.check(err) {
+			t.Fatalf("%s: unexpected error %#v", test.flagfile, err)
+		}
+	}
+
+	for _, setup := range []func(l *flagfile.Loader){
+		func(l *flagfile.Loader) { l.Alias("old-nope", "nope") },
+		func(l *flagfile.Loader) { l.Deprecate("old-nope", "nope", "") },
+		func(l *flagfile.Loader) { l.LoadE(flagfile.SkipArgs()) },
+	} {
+		l := flagfile.NewLoader(flag.NewFlagSet("test", flag.ContinueOnError))
+		setup(l)
+		err := l.LoadE(flagfile.SkipArgs())
+		if _, ok := err.(*flagfile.DefinitionError); !ok {
+			t.Fatalf("expected a definition error, got %#v", err)
+		}
+	}
+}
+
+func TestLoaderReload(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeFlagfile(t, dir, "a.conf", "a = 1\nb = 2\nc = 3\nd = 0\n")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	a := fs.Int("a", 0, "")
+	b := fs.Int("b", 0, "")
+	c := fs.Int("c", 0, "")
+	fs.Int("d", 0, "")
+	l := flagfile.NewLoader(fs)
+	var changes []string
+	l.OnChange("a", func(old, new string) {
+		changes = append(changes, "a:"+old+"->"+new)
+	})
+	l.OnChange("b", func(old, new string) {
+		changes = append(changes, "b:"+old+"->"+new)
+	})
+	err := l.LoadE(flagfile.Flagfile(path),
+		flagfile.Arguments([]string{"-b=20"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFlagfile(t, dir, "a.conf", "a = 5\nb = 6\n")
+	err = l.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *a != 5 || *b != 20 || *c != 0 || l.IsActivelySet("c") ||
+		l.IsActivelySet("d") {
+		t.Fatalf("unexpected values: %d %d %d", *a, *b, *c)
+	}
+	if len(changes) != 1 || changes[0] != "a:1->5" {
+		t.Fatalf("unexpected changes: %v", changes)
+	}
+
+	writeFlagfile(t, dir, "a.conf", "a = 7\nc = nope\n")
+	if l.Reload() == nil {
+		t.Fatal("expected an error")
+	}
+	if *a != 5 || *c != 0 {
+		t.Fatalf("failed reload was applied: %d %d", *a, *c)
+	}
+}
+
+func TestLoaderEnv(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeFlagfile(t, dir, "a.conf", "server.timeout = 1s\nb = 2\n")
+	os.Setenv("FLAGFILETEST_SERVER_TIMEOUT", "5s")
+	os.Setenv("FLAGFILETEST_B", "3")
+	defer os.Unsetenv("FLAGFILETEST_SERVER_TIMEOUT")
+	defer os.Unsetenv("FLAGFILETEST_B")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	timeout := fs.String("server.timeout", "", "")
+	b := fs.Int("b", 0, "")
+	l := flagfile.NewLoader(fs)
+	err := l.LoadE(flagfile.Flagfile(path), flagfile.EnvPrefix("FLAGFILETEST_"),
+		flagfile.Arguments([]string{"-b=4"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *timeout != "5s" || *b != 4 || !l.IsActivelySet("server.timeout") {
+		t.Fatalf("unexpected values: %s %d", *timeout, *b)
+	}
+	// the flags that choose flagfiles aren't read from the environment
+	other := writeFlagfile(t, dir, "other.conf", "b = 5\n")
+	os.Setenv("FLAGFILETEST_FLAGFILE", other)
+	os.Setenv("FLAGFILETEST_FLAGPROFILE", "prod")
+	os.Setenv("FLAGFILETEST_FLAGOUT", filepath.Join(dir, "out.conf"))
+	defer os.Unsetenv("FLAGFILETEST_FLAGFILE")
+	defer os.Unsetenv("FLAGFILETEST_FLAGPROFILE")
+	defer os.Unsetenv("FLAGFILETEST_FLAGOUT")
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	b = fs.Int("b", 0, "")
+	l = flagfile.NewLoader(fs)
+	err = l.LoadE(flagfile.EnvPrefix("FLAGFILETEST_"), flagfile.SkipArgs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"flagfile", "flagprofile", "flagout"} {
+		if l.IsActivelySet(name) || fs.Lookup(name).Value.String() != "" {
+			t.Fatalf("%s set from the environment", name)
+		}
+	}
+	if *b != 3 {
+		t.Fatalf("unexpected value: %d", *b)
+	}
+}
+
+type mapSource map[string]string
+
+func (m mapSource) Name() string { return "map" }
+
+func (m mapSource) Load(ctx context.Context) (map[string]flagfile.Entry, error) {
+	entries := make(map[string]flagfile.Entry)
+	for name, value := range m {
+		entries[name] = flagfile.Entry{Value: value}
+	}
+	return entries, nil
+}
+
+func TestLoaderSources(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeFlagfile(t, dir, "a.conf", "a = 1\nb = 2\n")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	a := fs.Int("a", 0, "")
+	b := fs.Int("b", 0, "")
+	c := fs.Int("c", 3, "")
+	l := flagfile.NewLoader(fs)
+	err := l.LoadE(flagfile.Sources(
+		mapSource{"a": "10"},
+		flagfile.FlagfileSource(path),
+		mapSource{"b": "20", "c": "30"},
+		flagfile.DefaultSource()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *a != 10 || *b != 2 || *c != 30 {
+		t.Fatalf("unexpected values: %d %d %d", *a, *b, *c)
+	}
+}
+
+func TestLoaderOrigin(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	b := writeFlagfile(t, dir, "b.conf", "\nx = 2\n")
+	a := writeFlagfile(t, dir, "a.conf", "x = 1\nflagfile = "+b+"\ny = 3\n")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("x", 0, "")
+	fs.Int("y", 0, "")
+	fs.Int("z", 0, "")
+	l := flagfile.NewLoader(fs)
+	err := l.LoadE(flagfile.Flagfile(a), flagfile.Arguments([]string{"-y=4"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x := l.Origin("x")
+	if x.Source != "file" || x.Path != b || x.Line != 2 ||
+		len(x.Overrode) != 1 || x.Overrode[0].Path != a ||
+		x.Overrode[0].Line != 1 {
+		t.Fatalf("unexpected origin for x: %+v", x)
+	}
+	y := l.Origin("y")
+	if y.Source != "cmdline" || len(y.Overrode) != 1 ||
+		y.Overrode[0].String() != "file "+a+":3" {
+		t.Fatalf("unexpected origin for y: %+v", y)
+	}
+	if z := l.Origin("z"); z.Source != "default" || z.Value != "0" {
+		t.Fatalf("unexpected origin for z: %+v", z)
+	}
+}
+
+func TestLoaderInclude(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	err := os.Mkdir(filepath.Join(dir, "conf.d"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFlagfile(t, dir, "conf.d/b.conf", "y = 3\n")
+	writeFlagfile(t, dir, "conf.d/a.conf", "x = 2\ny = 2\n")
+	path := writeFlagfile(t, dir, "main.conf",
+		"include = conf.d/*.conf\nx = 1\n")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	x := fs.Int("x", 0, "")
+	y := fs.Int("y", 0, "")
+	l := flagfile.NewLoader(fs)
+	err = l.LoadE(flagfile.Flagfile(path), flagfile.SkipArgs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *x != 2 || *y != 3 {
+		t.Fatalf("unexpected values: %d %d", *x, *y)
+	}
+}
+
+func TestLoaderIncludeCycle(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeFlagfile(t, dir, "b.conf", "include = a.conf\n")
+	a := writeFlagfile(t, dir, "a.conf", "include = b.conf\n")
+
+	l := flagfile.NewLoader(flag.NewFlagSet("test", flag.ContinueOnError))
+	err := l.LoadE(flagfile.Flagfile(a), flagfile.SkipArgs())
+	cycle, ok := err.(*flagfile.IncludeCycleError)
+	if !ok {
+		t.Fatalf("expected a cycle error, got %v", err)
+	}
+	if len(cycle.Chain) != 3 || cycle.Chain[0] != a ||
+		filepath.Base(cycle.Chain[1]) != "b.conf" ||
+		filepath.Base(cycle.Chain[2]) != "a.conf" {
+		t.Fatalf("unexpected chain: %v", cycle.Chain)
+	}
+}
+
+func TestLoaderProfile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeFlagfile(t, dir, "a.conf", `
+[profile:prod server]
+port = 443
+[server]
+port = 80
+host = localhost
+[profile:dev server]
+port = 8080
+`)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	port := fs.Int("server.port", 0, "")
+	host := fs.String("server.host", "", "")
+	fs.Bool("verbose", false, "")
+	l := flagfile.NewLoader(fs)
+	err := l.LoadE(flagfile.Flagfile(path), flagfile.Profile("dev"),
+		flagfile.Arguments([]string{"-flagprofile=prod"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *port != 443 || *host != "localhost" {
+		t.Fatalf("unexpected values: %d %s", *port, *host)
+	}
+
+	var out bytes.Buffer
+	err = l.Dump(&out, flagfile.EffectiveOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[main]\nflagprofile = prod\n\n" +
+		"[server]\nhost = localhost\nport = 443\n"
+	if out.String() != expected {
+		t.Fatalf("unexpected dump:\n%s", out.String())
+	}
+}
+
+func TestLoaderInterpolate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	os.Setenv("FLAGFILETEST_HOME", "/home/test")
+	defer os.Unsetenv("FLAGFILETEST_HOME")
+	path := writeFlagfile(t, dir, "a.conf", `
+data.dir = ${flag:base}/data
+base = ${env:FLAGFILETEST_HOME}/${env}
+price = $$5
+`)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	data := fs.String("data.dir", "", "")
+	fs.String("base", "", "")
+	price := fs.String("price", "", "")
+	l := flagfile.NewLoader(fs)
+	err := l.LoadE(flagfile.Flagfile(path), flagfile.Interpolate(),
+		flagfile.Facts(map[string]string{"env": "prod"}), flagfile.SkipArgs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *data != "/home/test/prod/data" || *price != "$5" {
+		t.Fatalf("unexpected values: %s %s", *data, *price)
+	}
+
+	var out bytes.Buffer
+	err = l.Dump(&out, flagfile.EffectiveOnly(), flagfile.Raw())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[data]\ndir = ${flag:base}/data\n\n" +
+		"[main]\nbase = ${env:FLAGFILETEST_HOME}/${env}\nprice = $$5\n"
+	if out.String() != expected {
+		t.Fatalf("unexpected dump:\n%s", out.String())
+	}
+
+	path = writeFlagfile(t, dir, "b.conf", "a = ${flag:b}\nb = ${flag:a}\n")
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("a", "", "")
+	fs.String("b", "", "")
+	l = flagfile.NewLoader(fs)
+	err = l.LoadE(flagfile.Flagfile(path), flagfile.Interpolate(),
+		flagfile.SkipArgs())
+	if _, ok := err.(*flagfile.InterpolationError); !ok {
+		t.Fatalf("expected an interpolation error, got %v", err)
+	}
+
+	// references see values set through aliases
+	path = writeFlagfile(t, dir, "c.conf",
+		"base-old = /srv\ndir = ${flag:base}/d\n")
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("base", "/default", "")
+	dir_flag := fs.String("dir", "", "")
+	l = flagfile.NewLoader(fs)
+	l.Alias("base-old", "base")
+	err = l.LoadE(flagfile.Flagfile(path), flagfile.Interpolate(),
+		flagfile.SkipArgs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *dir_flag != "/srv/d" {
+		t.Fatalf("unexpected value: %s", *dir_flag)
+	}
+}
+
+func TestLoaderSecrets(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	secret := writeFlagfile(t, dir, "secret", "hunter2\n")
+	path := writeFlagfile(t, dir, "a.conf", "db.password = @file:"+secret+"\n")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	password := fs.String("db.password", "", "")
+	l := flagfile.NewLoader(fs)
+	err := l.LoadE(flagfile.Flagfile(path), flagfile.SkipArgs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *password != "hunter2" || !l.IsSecret("db.password") {
+		t.Fatalf("unexpected password %#v", *password)
+	}
+	if origin := l.Origin("db.password"); origin.Value != "<redacted>" {
+		t.Fatalf("secret not redacted: %+v", origin)
+	}
+
+	var out bytes.Buffer
+	err = l.Dump(&out, flagfile.EffectiveOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "[db]\npassword = @file:"+secret+"\n" {
+		t.Fatalf("unexpected dump:\n%s", out.String())
+	}
+
+	// references to secrets see their values, and are secret too
+	path = writeFlagfile(t, dir, "b.conf",
+		"pw = @file:"+secret+"\ndsn = u:${flag:pw}@h\n")
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("pw", "", "")
+	dsn := fs.String("dsn", "", "")
+	l = flagfile.NewLoader(fs)
+	err = l.LoadE(flagfile.Flagfile(path), flagfile.Interpolate(),
+		flagfile.SkipArgs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *dsn != "u:hunter2@h" || !l.IsSecret("dsn") ||
+		l.Origin("dsn").Value != "<redacted>" {
+		t.Fatalf("unexpected dsn %#v", *dsn)
+	}
+	out.Reset()
+	err = l.Dump(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "hunter2") {
+		t.Fatalf("secret dumped:\n%s", out.String())
+	}
+
+	// defaults are never read as secret references
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	key := fs.String("key", "@file:"+filepath.Join(dir, "missing"), "")
+	l = flagfile.NewLoader(fs)
+	err = l.LoadE(flagfile.SkipArgs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *key != "@file:"+filepath.Join(dir, "missing") || l.IsSecret("key") {
+		t.Fatalf("default read as a secret: %#v", *key)
+	}
+}
+
+func TestLoaderDuplicates(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	b := writeFlagfile(t, dir, "b.conf", "x = 2\n")
+	a := writeFlagfile(t, dir, "a.conf", "x = 1\nflagfile = "+b+"\n")
+
+	for _, test := range []struct {
+		policy   flagfile.DuplicatePolicy
+		expected int
+	}{
+		{flagfile.LastWins, 2},
+		{flagfile.FirstWins, 1},
+		{flagfile.RejectDuplicates, 0},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		x := fs.Int("x", 0, "")
+		l := flagfile.NewLoader(fs)
+		err := l.LoadE(flagfile.Flagfile(a), flagfile.SkipArgs(),
+			flagfile.Duplicates(test.policy))
+		if test.policy == flagfile.RejectDuplicates {
+			dup, ok := err.(*flagfile.DuplicateFlagError)
+			if !ok || dup.FirstPath != a || dup.FirstLine != 1 ||
+				dup.Path != b || dup.Line != 1 {
+				t.Fatalf("expected a duplicate error, got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *x != test.expected {
+			t.Fatalf("policy %d: got %d, expected %d",
+				test.policy, *x, test.expected)
+		}
+	}
+}
+
+func TestLoaderDeprecate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeFlagfile(t, dir, "a.conf", "old-a = 1\nold-b = 2\nb = 3\n")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	a := fs.Int("a", 0, "")
+	b := fs.Int("b", 0, "")
+	l := flagfile.NewLoader(fs)
+	l.Deprecate("old-a", "a", "renamed")
+	l.Deprecate("old-b", "b", "renamed")
+	err := l.LoadE(flagfile.Flagfile(path), flagfile.SkipArgs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *a != 1 || *b != 3 || !l.IsActivelySet("a") {
+		t.Fatalf("unexpected values: %d %d", *a, *b)
+	}
+	if p := l.Origin("a"); p.Alias != "old-a" || p.Line != 1 {
+		t.Fatalf("unexpected origin: %v", p)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("a", 0, "")
+	l = flagfile.NewLoader(fs)
+	l.Deprecate("old-a", "a", "renamed")
+	err = l.LoadE(flagfile.Flagfile(path), flagfile.IgnoreUnknownFlags(),
+		flagfile.SkipArgs(), flagfile.StrictDeprecations())
+	dep, ok := err.(*flagfile.DeprecatedFlagError)
+	if !ok || dep.Name != "old-a" || dep.Path != path || dep.Line != 1 {
+		t.Fatalf("expected a deprecated flag error, got %v", err)
+	}
+
+	// a deprecated name is rejected even if its replacement is also set
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("b", 0, "")
+	l = flagfile.NewLoader(fs)
+	l.Deprecate("old-b", "b", "renamed")
+	err = l.LoadE(flagfile.Flagfile(path), flagfile.IgnoreUnknownFlags(),
+		flagfile.SkipArgs(), flagfile.StrictDeprecations())
+	dep, ok = err.(*flagfile.DeprecatedFlagError)
+	if !ok || dep.Name != "old-b" || dep.Line != 2 {
+		t.Fatalf("expected a deprecated flag error, got %v", err)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("b", 0, "")
+	l = flagfile.NewLoader(fs)
+	l.Deprecate("old-b", "b", "renamed")
+	err = l.LoadE(flagfile.Arguments([]string{"-b=1", "-old-b=2"}))
+	if _, ok := err.(*flagfile.AliasConflictError); !ok {
+		t.Fatalf("expected an alias conflict error, got %v", err)
+	}
+}
+
+func TestLoaderRequire(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("a", "", "")
+	fs.String("b", "", "")
+	fs.String("c", "", "")
+	l := flagfile.NewLoader(fs)
+	l.Alias("old-b", "b")
+	l.Require("a", "b", "c")
+	err := l.LoadE(flagfile.Arguments([]string{"-old-b=x"}))
+	missing, ok := err.(*flagfile.MissingFlagsError)
+	if !ok || len(missing.Names) != 2 ||
+		missing.Names[0] != "a" || missing.Names[1] != "c" {
+		t.Fatalf("expected a missing flags error, got %v", err)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("a", "", "")
+	l = flagfile.NewLoader(fs)
+	l.Require("nope")
+	err = l.LoadE(flagfile.Arguments([]string{"-a=x"}))
+	unknown, ok := err.(*flagfile.UnknownFlagError)
+	if !ok || unknown.Name != "nope" {
+		t.Fatalf("expected an unknown flag error, got %v", err)
+	}
+}
+
+func TestLoaderValidate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeFlagfile(t, dir, "a.conf", "workers = -5\nmode = fsatr\n")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("workers", 1, "")
+	fs.String("mode", "fast", "")
+	fs.String("name", "", "")
+	l := flagfile.NewLoader(fs)
+	l.Validate("workers", flagfile.Range(1, 64))
+	l.Validate("mode", flagfile.OneOf("fast", "slow"))
+	l.Validate("name", flagfile.Matches("^[a-z]*$"))
+	err := l.LoadE(flagfile.Flagfile(path), flagfile.SkipArgs())
+	errs, ok := err.(flagfile.ValidationErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+	if errs[0].Name != "mode" || errs[0].Origin.Line != 2 ||
+		errs[1].Name != "workers" || errs[1].Origin.Line != 1 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+
+	// failed checks on reload and Set are never seen by dynamic flags
+	path = writeFlagfile(t, dir, "b.conf", "n = 5\n")
+	l = flagfile.NewLoader(flag.NewFlagSet("test", flag.ContinueOnError))
+	n := l.DynamicInt("n", 1, "")
+	l.Validate("n", flagfile.Range(1, 10))
+	changes := n.Subscribe()
+	err = l.LoadE(flagfile.Flagfile(path), flagfile.SkipArgs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-changes
+	writeFlagfile(t, dir, "b.conf", "n = 500\n")
+	if _, ok := l.Reload().(flagfile.ValidationErrors); !ok {
+		t.Fatal("expected validation errors")
+	}
+	if _, ok := l.Set("n", "500", "").(flagfile.ValidationErrors); !ok {
+		t.Fatal("expected validation errors")
+	}
+	select {
+	case v := <-changes:
+		t.Fatalf("subscriber saw rejected value %d", v)
+	default:
+	}
+	if n.Get() != 5 || l.Origin("n").Source != "file" {
+		t.Fatalf("rejected value applied: %d", n.Get())
+	}
+
+	l = flagfile.NewLoader(flag.NewFlagSet("test", flag.ContinueOnError))
+	l.Validate("nope", flagfile.NonEmpty)
+	err = l.LoadE(flagfile.SkipArgs())
+	if _, ok := err.(*flagfile.UnknownFlagError); !ok {
+		t.Fatalf("expected an unknown flag error, got %v", err)
+	}
+}
+
+func TestLoaderConstraints(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("tls.cert", "", "")
+	fs.String("tls.key", "", "")
+	fs.String("listen.unix", "", "")
+	fs.Int("listen.port", 0, "")
+	fs.Bool("verbose", false, "")
+	fs.String("log", "", "")
+	l := flagfile.NewLoader(fs)
+	l.RequiredTogether("tls.cert", "tls.key")
+	l.MutuallyExclusive("listen.unix", "listen.port")
+	l.Implies("verbose", "log")
+	err := l.LoadE(flagfile.Arguments([]string{"-tls.cert=a",
+		"-listen.unix=b", "-listen.port=1", "-verbose", "-log=c"}))
+	errs, ok := err.(flagfile.ConstraintErrors)
+	if !ok || len(errs) != 2 || errs[0].Kind != flagfile.Together ||
+		errs[1].Kind != flagfile.Exclusive || len(errs[1].Set) != 2 {
+		t.Fatalf("expected constraint errors, got %v", err)
+	}
+}
+
+func TestLoaderFreeze(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeFlagfile(t, dir, "a.conf", "a = 1\n")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	a := fs.Int("a", 0, "")
+	l := flagfile.NewLoader(fs)
+	err := l.LoadE(flagfile.Flagfile(path), flagfile.SkipArgs(),
+		flagfile.Freeze())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fs.Set("a", "2")
+	if _, ok := err.(*flagfile.FrozenFlagError); !ok || *a != 1 {
+		t.Fatalf("expected a frozen flag error, got %v", err)
+	}
+	err = l.Set("a", "3", "testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := l.AuditLog()
+	if *a != 3 || len(log) != 1 || log[0].Old != "1" || log[0].New != "3" ||
+		log[0].Reason != "testing" || l.Origin("a").Source != "runtime" {
+		t.Fatalf("unexpected audit log: %v", log)
+	}
+	err = l.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *a != 3 {
+		t.Fatalf("reload replaced runtime value with %d", *a)
+	}
+	err = l.Set("a", "4", "testing again")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *a != 4 || l.Origin("a").Overrode[0].Value != "1" {
+		t.Fatalf("reload replaced second runtime value with %d", *a)
+	}
+	writeFlagfile(t, dir, "a.conf", "a = 5\n")
+	err = l.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *a != 5 {
+		t.Fatalf("reload kept runtime value over changed flagfile: %d", *a)
+	}
+}
+
+func TestLoaderDynamic(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeFlagfile(t, dir, "a.conf", "n = 1\nd = 1s\n")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	l := flagfile.NewLoader(fs)
+	n := l.DynamicInt("n", 5, "")
+	d := l.DynamicDuration("d", time.Minute, "")
+	s := l.DynamicString("s", "x", "")
+	changes := n.Subscribe()
+	err := l.LoadE(flagfile.Flagfile(path), flagfile.SkipArgs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Get() != 1 || d.Get() != time.Second || s.Get() != "x" ||
+		<-changes != 1 {
+		t.Fatalf("unexpected values: %d %s %s", n.Get(), d.Get(), s.Get())
+	}
+	writeFlagfile(t, dir, "a.conf", "n = 2\n")
+	err = l.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Get() != 2 || d.Get() != time.Minute || <-changes != 2 {
+		t.Fatalf("unexpected values after reload: %d %s", n.Get(), d.Get())
+	}
+
+	// PrintDefaults calls String on zero values
+	fs.SetOutput(ioutil.Discard)
+	fs.PrintDefaults()
+	var zero flagfile.StringFlag
+	if zero.Get() != "" {
+		t.Fatalf("unexpected zero value %#v", zero.Get())
+	}
+
+	// errors don't repeat secret values
+	l.Secret("n")
+	writeFlagfile(t, dir, "a.conf", "n = hunter2\n")
+	err = l.Reload()
+	if _, ok := err.(*flagfile.ValueError); !ok ||
+		strings.Contains(err.Error(), "hunter2") {
+		t.Fatalf("expected a redacted value error, got %v", err)
+	}
+}
+
+func TestLoaderPublishExpvar(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("a", "x", "")
+	fs.String("password", "hunter2", "")
+	l := flagfile.NewLoader(fs)
+	l.Alias("b", "a")
+	l.Secret("password")
+	err := l.LoadE(flagfile.SkipArgs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.PublishExpvar("test-flags")
+	vals := expvar.Get("test-flags").(expvar.Func)().(map[string]string)
+	if _, ok := vals["b"]; ok || vals["a"] != "x" ||
+		vals["password"] != "<redacted>" {
+		t.Fatalf("unexpected published values: %v", vals)
+	}
+	if len(expvar.Get("test-flags.hash").String()) != 66 {
+		t.Fatalf("unexpected hash %s", expvar.Get("test-flags.hash"))
+	}
+}
+
+func TestLoaderSuggestions(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeFlagfile(t, dir, "a.conf", "[sever]\ntimeout = 1s\n")
+
+	newLoader := func() *flagfile.Loader {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.Duration("server.timeout", 0, "")
+		fs.Int("server.port", 0, "")
+		fs.Bool("verbose", false, "")
+		return flagfile.NewLoader(fs)
+	}
+	err := newLoader().LoadE(flagfile.Flagfile(path), flagfile.SkipArgs())
+	unknown, ok := err.(*flagfile.UnknownFlagError)
+	if !ok || unknown.Line != 2 || len(unknown.Suggestions) != 1 ||
+		unknown.Suggestions[0] != "server.timeout" {
+		t.Fatalf("expected a suggestion, got %v", err)
+	}
+
+	path = writeFlagfile(t, dir, "b.conf", "sever.limit = 1\n")
+	err = newLoader().LoadE(flagfile.Flagfile(path), flagfile.SkipArgs())
+	unknown, ok = err.(*flagfile.UnknownFlagError)
+	if !ok || len(unknown.Suggestions) != 1 ||
+		unknown.Suggestions[0] != "[server]" {
+		t.Fatalf("expected a section suggestion, got %v", err)
+	}
+
+	err = newLoader().LoadE(flagfile.Arguments(
+		[]string{"-verbose", "-server.port", "1", "-verbos"}))
+	unknown, ok = err.(*flagfile.UnknownFlagError)
+	if !ok || len(unknown.Suggestions) != 1 ||
+		unknown.Suggestions[0] != "verbose" {
+		t.Fatalf("expected a suggestion, got %v", err)
+	}
+}
+
+func TestLoaderCommand(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeFlagfile(t, dir, "a.conf",
+		"verbose = true\n[cmd.serve]\nport = 80\naddr = host\n")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	verbose := fs.Bool("verbose", false, "")
+	l := flagfile.NewLoader(fs)
+	var port *int
+	var addr *string
+	var ran []string
+	l.Command("serve", func(fs *flag.FlagSet) {
+		port = fs.Int("port", 0, "")
+		addr = fs.String("addr", "", "")
+	}, func(args []string) error {
+		ran = args
+		return nil
+	})
+	err := l.LoadE(flagfile.Flagfile(path), flagfile.Arguments(
+		[]string{"serve", "-port=8080", "extra"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !*verbose || *port != 8080 || *addr != "host" ||
+		len(ran) != 1 || ran[0] != "extra" {
+		t.Fatalf("unexpected values: %v %d %s %v", *verbose, *port, *addr, ran)
+	}
+}
+
+func TestLoaderInterspersedArgs(t *testing.T) {
+	for _, test := range []struct {
+		interspersed bool
+		verbose      bool
+		args         []string
+	}{
+		{false, false, []string{"file.txt", "-verbose", "--", "-n", "2"}},
+		{true, true, []string{"file.txt", "-n", "2"}},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		verbose := fs.Bool("verbose", false, "")
+		fs.Int("n", 0, "")
+		l := flagfile.NewLoader(fs)
+		opts := []flagfile.Option{flagfile.Arguments([]string{
+			"-n", "1", "file.txt", "-verbose", "--", "-n", "2"})}
+		if test.interspersed {
+			opts = append(opts, flagfile.InterspersedArgs())
+		}
+		err := l.LoadE(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *verbose != test.verbose || len(l.Args()) != len(test.args) {
+			t.Fatalf("unexpected results: %v %v", *verbose, l.Args())
+		}
+		for i, arg := range test.args {
+			if l.Args()[i] != arg {
+				t.Fatalf("unexpected args: %v", l.Args())
+			}
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// CommandLine is the default Loader, used by the top-level functions of this
+// package. It loads flags into flag.CommandLine.
+var CommandLine = NewLoader(flag.CommandLine)
+
+// Loader loads the flags of a single flag.FlagSet from the command line and
+// from flagfiles, and keeps track of that flag set's aliases and which of its
+// flags were set. Libraries, subcommands and tests that want their own
+// isolated configuration can make their own Loader; everything else should
+// use the top-level functions, which operate on CommandLine.
+type Loader struct {
+	fs          *flag.FlagSet
+	flagfile    *string
+	flagOutPath *string
+	flagprofile *string
+
+	mtx         sync.Mutex
+	loaded      bool
+	set_flags   map[string]bool
+	all_aliases map[string][]string
+	alias_set   map[string]bool
+	secrets     map[string]bool
+	deprecated  map[string]deprecation
+	required    map[string]bool
+	validators  map[string][]func(flag.Getter) error
+	constraints []constraint
+	mutable     map[string]bool
+	commands    map[string]*command
+
+	// state kept around for reloading
+	cfg       *config
+	sources   []Source
+	results   []map[string]Entry
+	values    map[string]value
+	callbacks map[string][]func(old, new string)
+	audit     []AuditRecord
+
+	// done is closed by Close to stop the running watch and signal
+	// goroutines
+	done    chan struct{}
+	running sync.WaitGroup
+
+	// flagfile entries for subcommand flags, keyed by command and flag name
+	command_entries map[string]map[string]Entry
+}
+
+// NewLoader returns a Loader for the given flag set. It defines the
+// flagfile, flagout and flagprofile flags on fs.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := newLoader(fs)
+	l.flagfile = fs.String("flagfile", "", "a file (or multiple files, "+
+		"comma-separated) from which to load flags")
+	l.flagOutPath = fs.String("flagout", "",
+		"a file in which to write all configured settings")
+	l.flagprofile = fs.String("flagprofile", "",
+		"the profile to use from flagfiles with profile sections")
+	return l
+}
+
+// newLoader returns a Loader for the given flag set without defining any
+// flags on it.
+func newLoader(fs *flag.FlagSet) *Loader {
+	return &Loader{
+		fs:          fs,
+		flagfile:    new(string),
+		flagOutPath: new(string),
+		flagprofile: new(string),
+		set_flags:   make(map[string]bool),
+		all_aliases: make(map[string][]string),
+		alias_set:   make(map[string]bool),
+		secrets:     make(map[string]bool),
+		deprecated:  make(map[string]deprecation),
+		required:    make(map[string]bool),
+		validators:  make(map[string][]func(flag.Getter) error),
+		mutable:     make(map[string]bool),
+		commands:    make(map[string]*command),
+		callbacks:   make(map[string][]func(old, new string)),
+	}
+}
+
+// FlagSet returns the flag set the Loader loads flags into.
+func (l *Loader) FlagSet() *flag.FlagSet { return l.fs }
+
+// IsActivelySet returns whether or not the user configured the given flag.
+// The value is false if the flag was not set by commandline, environment or
+// flagfile.
+func (l *Loader) IsActivelySet(flag_name string) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.set_flags[flag_name]
+}
+
+func (l *Loader) setFlag(flag_name string, e Entry) error {
+	f := l.fs.Lookup(flag_name)
+	if f == nil {
+		return l.unknownFlag(flag_name, e.Path, e.Line)
+	}
+	if frozen, ok := f.Value.(*frozenValue); ok {
+		atomic.StoreInt32(&frozen.thawed, 1)
+		defer atomic.StoreInt32(&frozen.thawed, 0)
+	}
+	err := l.fs.Set(flag_name, e.Value)
+	if err != nil {
+		return &ValueError{Name: flag_name,
+			Value: l.redact(flag_name, e.Value),
+			Path:  e.Path, Line: e.Line, Err: err}
+	}
+	return nil
+}
+
+// Load is the flagfile equivalent/replacement for FlagSet.Parse. Call it
+// once. Load panics if the flags can't be loaded; see LoadE for a version
+// that returns an error instead.
+func (l *Loader) Load(opts ...Option) {
+	err := l.LoadE(opts...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// LoadE is like Load but returns an error instead of panicking when a
+// flagfile can't be opened or parsed, or sets an unknown flag or a bad value.
+// The error will be one of *OpenError, *ParseError, *UnknownFlagError,
+// *ValueError, *AliasConflictError, *DeprecatedFlagError, *MissingFlagsError,
+// ConstraintErrors or ValidationErrors, or whatever a Source returned. It
+// returns a *DefinitionError if aliases or deprecations name flags that don't
+// exist, or if flags were already loaded.
+func (l *Loader) LoadE(opts ...Option) error {
+	defer l.flagOut()
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.loaded {
+		return &DefinitionError{Err: fmt.Errorf("flags already loaded")}
+	}
+
+	err := l.defineAliases()
+	if err != nil {
+		return err
+	}
+	err = l.defineDeprecated()
+	if err != nil {
+		return err
+	}
+
+	l.cfg = newConfig(l, opts)
+	l.sources = l.cfg.sources
+	if l.sources == nil {
+		l.sources = l.cfg.defaultSources()
+	}
+	l.loaded = true
+
+	ctx := l.context()
+	l.results = make([]map[string]Entry, len(l.sources))
+	for i, src := range l.sources {
+		entries, err := src.Load(ctx)
+		if err != nil {
+			return err
+		}
+		l.results[i] = entries
+	}
+
+	err = l.checkDeprecated(l.results)
+	if err != nil {
+		return err
+	}
+	l.values = l.merge(l.results)
+	l.command_entries = l.takeCommandEntries(l.values)
+	// secrets are read first so that references to them see their values
+	err = l.readSecrets(l.values)
+	if err != nil {
+		return err
+	}
+	if l.cfg.interpolate {
+		err := l.interpolate(l.values)
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedNames(l.values) {
+		val := l.values[name]
+		if !val.active() {
+			continue
+		}
+		if !val.applied() {
+			if l.cfg.ignoreUnknowns && l.fs.Lookup(name) == nil {
+				delete(l.values, name)
+				continue
+			}
+			err := l.setFlag(name, val.entry)
+			if err != nil {
+				return err
+			}
+		}
+		l.set_flags[name] = true
+	}
+
+	err = l.setAliases()
+	if err != nil {
+		return err
+	}
+	err = l.checkRequired(l.set_flags)
+	if err != nil {
+		return err
+	}
+	err = l.checkConstraints(l.set_flags)
+	if err != nil {
+		return err
+	}
+	err = l.validate(nil)
+	if err != nil {
+		return err
+	}
+	if l.cfg.freeze {
+		l.freeze()
+	}
+	l.done = make(chan struct{})
+	if l.cfg.watchInterval > 0 {
+		// stamp before returning so that changes made right after Load
+		// aren't missed
+		l.running.Add(1)
+		go l.watch(l.cfg.watchInterval, stampFiles(l.watchedFlagfiles()),
+			l.done)
+	}
+	if len(l.cfg.reloadSignals) > 0 {
+		l.running.Add(1)
+		l.handleSignals(l.cfg.reloadSignals, l.done)
+	}
+	return nil
+}
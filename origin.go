@@ -0,0 +1,103 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"fmt"
+)
+
+// Provenance describes where a flag's value came from.
+type Provenance struct {
+	// Source is the Name of the Source the value came from, such as
+	// "default", "cmdline", "env" or "file", or "alias" if the value was set
+	// through one of the flag's aliases.
+	Source string
+	// Alias is the name the value was set through, if it wasn't the flag's
+	// own name: an alias if Source is "alias", or else a deprecated name.
+	Alias string
+	Value string
+	// Raw is the value as it was written, if it was changed by Interpolate.
+	Raw string
+	// Path and Line locate the value within its Source, if possible, such as
+	// the flagfile and line number or the environment variable.
+	Path string
+	Line int
+	// Overrode lists the lower precedence assignments that this value took
+	// the place of, most recent first.
+	Overrode []Provenance
+}
+
+func (p Provenance) String() string {
+	where := p.Source
+	if p.Alias != "" {
+		where = fmt.Sprintf("%s %#v", where, p.Alias)
+	}
+	if p.Path != "" {
+		where += " " + location(p.Path, p.Line)
+	}
+	return where
+}
+
+func provenance(src Source, e Entry) Provenance {
+	return Provenance{
+		Source: src.Name(), Value: e.Value, Path: e.Path, Line: e.Line}
+}
+
+// Origin returns where the named flag's value came from when flags were
+// loaded.
+func Origin(flag_name string) Provenance {
+	return CommandLine.Origin(flag_name)
+}
+
+// Origin returns where the named flag's value came from when flags were
+// loaded. The zero Provenance is returned for flags that don't exist, and the
+// values of secret flags are redacted.
+func (l *Loader) Origin(flag_name string) Provenance {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.origin(flag_name)
+}
+
+func (l *Loader) origin(flag_name string) Provenance {
+	p := l.unredactedOrigin(flag_name)
+	if l.isSecret(flag_name) {
+		p.Value = redacted
+		p.Overrode = append([]Provenance(nil), p.Overrode...)
+		for i := range p.Overrode {
+			p.Overrode[i].Value = redacted
+		}
+	}
+	return p
+}
+
+func (l *Loader) unredactedOrigin(flag_name string) Provenance {
+	f := l.fs.Lookup(flag_name)
+	if f == nil {
+		return Provenance{}
+	}
+	if val, ok := l.values[flag_name]; ok && val.active() {
+		p := provenance(val.source, val.entry)
+		p.Alias, p.Raw, p.Overrode = val.via, val.raw, val.overrode
+		return p
+	}
+	for _, name := range l.aliasGroup(flag_name) {
+		if val, ok := l.values[name]; ok && val.active() {
+			p := provenance(val.source, val.entry)
+			p.Source, p.Alias = "alias", name
+			return p
+		}
+	}
+	return Provenance{Source: "default", Value: f.DefValue}
+}
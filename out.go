@@ -23,42 +23,92 @@ import (
 	"github.com/spacemonkeygo/flagfile/parser"
 )
 
-var (
-	flagOutPath = flag.String("flagout", "",
-		"a file in which to write all configured settings")
-)
-
-func flagOut() {
-	if *flagOutPath != "" {
-		err := DumpToPath(*flagOutPath)
+func (l *Loader) flagOut() {
+	if *l.flagOutPath != "" {
+		err := l.DumpToPath(*l.flagOutPath)
 		if err != nil {
 			log.Printf("failed writing requested flagout file: %s", err)
 		}
 	}
 }
 
+// DumpOption changes what Dump writes.
+type DumpOption struct {
+	effectiveOnly bool
+	raw           bool
+}
+
+// EffectiveOnly tells Dump to only write flags that were actively set, with
+// the values they ended up with, instead of every flag. Since profile
+// sections and precedence have already been resolved, the result is a plain
+// flagfile describing just the effective configuration.
+func EffectiveOnly() DumpOption { return DumpOption{effectiveOnly: true} }
+
+// Raw tells Dump to write values that were expanded by Interpolate as they
+// were originally written, references and all, instead of their expanded
+// values.
+func Raw() DumpOption { return DumpOption{raw: true} }
+
 // Dump will write all configured flags to the given io.Writer in the flagfile
-// serialization format for later parsing.
-func Dump(out io.Writer) error {
-	mtx.Lock()
-	defer mtx.Unlock()
+// serialization format for later parsing. Secret flags are written as the
+// @file: reference they were loaded from, if any, or are redacted.
+func Dump(out io.Writer, opts ...DumpOption) error {
+	return CommandLine.Dump(out, opts...)
+}
+
+// DumpToPath simply calls Dump on a new filehandle (O_CREATE|O_TRUNC) for the
+// given path
+func DumpToPath(path string, opts ...DumpOption) error {
+	return CommandLine.DumpToPath(path, opts...)
+}
+
+// Dump will write all of the Loader's configured flags to the given
+// io.Writer in the flagfile serialization format for later parsing.
+func (l *Loader) Dump(out io.Writer, opts ...DumpOption) error {
+	var effectiveOnly, raw bool
+	for _, opt := range opts {
+		if opt.effectiveOnly {
+			effectiveOnly = true
+		}
+		if opt.raw {
+			raw = true
+		}
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return parser.Serialize(l.dumpValues(effectiveOnly, raw), out)
+}
+
+// dumpValues returns the values Dump writes, keyed by flag name.
+func (l *Loader) dumpValues(effectiveOnly, raw bool) map[string]string {
 	vals := make(map[string]string)
-	flag.VisitAll(func(f *flag.Flag) {
-		if !isAlias(f.Name) {
-			vals[f.Name] = f.Value.String()
+	l.fs.VisitAll(func(f *flag.Flag) {
+		if l.isAlias(f.Name) || l.isDeprecated(f.Name) {
+			return
+		}
+		if effectiveOnly && !l.anySet(l.aliasGroup(f.Name)) {
+			return
+		}
+		val, ok := l.values[f.Name]
+		switch {
+		case ok && val.raw != "" && (raw || l.isSecret(f.Name)):
+			// secrets read from files are written as their reference
+			vals[f.Name] = val.raw
+		default:
+			vals[f.Name] = l.redact(f.Name, f.Value.String())
 		}
 	})
-	return parser.Serialize(vals, out)
+	return vals
 }
 
 // DumpToPath simply calls Dump on a new filehandle (O_CREATE|O_TRUNC) for the
 // given path
-func DumpToPath(path string) error {
+func (l *Loader) DumpToPath(path string, opts ...DumpOption) error {
 	fh, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
 		0600)
 	if err != nil {
 		return err
 	}
 	defer fh.Close()
-	return Dump(fh)
+	return l.Dump(fh, opts...)
 }
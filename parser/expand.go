@@ -0,0 +1,63 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Expand replaces every reference of the form ${ref} in value with what
+// lookup returns for ref, and every "$$" with a single "$". Any other "$" is
+// left alone. What a reference means is up to lookup; flagfile uses
+// ${env:NAME} for environment variables, ${flag:name} for flags and ${name}
+// for facts.
+func Expand(value string, lookup func(ref string) (string, error)) (
+	string, error) {
+	if !strings.Contains(value, "$") {
+		return value, nil
+	}
+	var out bytes.Buffer
+	for len(value) > 0 {
+		pos := strings.Index(value, "$")
+		if pos == -1 || pos == len(value)-1 {
+			out.WriteString(value)
+			break
+		}
+		out.WriteString(value[:pos])
+		value = value[pos:]
+		switch value[1] {
+		case '$':
+			out.WriteByte('$')
+			value = value[2:]
+		case '{':
+			end := strings.Index(value, "}")
+			if end == -1 {
+				return "", fmt.Errorf("unterminated reference in %#v", value)
+			}
+			replacement, err := lookup(value[2:end])
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(replacement)
+			value = value[end+1:]
+		default:
+			out.WriteByte('$')
+			value = value[1:]
+		}
+	}
+	return out.String(), nil
+}
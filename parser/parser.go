@@ -20,6 +20,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"path"
 	"strings"
 )
 
@@ -50,7 +51,72 @@ import (
 //    flag2 = true
 //
 func Parse(in io.Reader, cb func(key, value string)) error {
-	section := ""
+	return ParseSettings(in, func(s Setting) { cb(s.Key, s.Value) })
+}
+
+// Setting is a single key and unparsed value found by ParseSettings.
+type Setting struct {
+	Key   string
+	Value string
+	// Line is the line number the setting was found on, starting at 1.
+	Line int
+	// Profile is the profile of the section the setting was found in, if it
+	// was found in a profile section.
+	Profile string
+}
+
+// ParseSettings is like Parse but calls the given callback with a Setting,
+// which also says where in the file the key and value were found.
+func ParseSettings(in io.Reader, cb func(s Setting)) error {
+	return (&Parser{}).ParseSettings(in, cb)
+}
+
+// Parser parses flagfiles with conditional sections. A section header may
+// follow its name with conditions of the form @fact=pattern, and the keys in
+// that section are only used if every condition matches. Patterns are
+// matched against the Parser's Facts using path.Match, and facts that
+// aren't set never match. For example, with the facts host=db-3 and
+// env=prod:
+//
+//    [server @host=db-*]
+//    port = 5432          # used
+//
+//    [server @env=staging]
+//    port = 5433          # skipped
+//
+//    [@env=prod]
+//    verbose = false      # used, with no section prefix
+//
+// A section header may also start with profile:name, in which case the
+// section is only used if the Parser's Profile is name, and its settings
+// have their Profile set. For example, with the profile prod:
+//
+//    [profile:prod]
+//    verbose = false      # used
+//
+//    [profile:prod server]
+//    port = 443           # used, as server.port
+//
+//    [profile:dev server]
+//    port = 8080          # skipped
+//
+// The zero Parser has no facts or profile, so it skips every conditional and
+// profile section.
+type Parser struct {
+	Facts   map[string]string
+	Profile string
+}
+
+// Parse is like the package-level Parse, but handles conditional sections.
+func (p *Parser) Parse(in io.Reader, cb func(key, value string)) error {
+	return p.ParseSettings(in, func(s Setting) { cb(s.Key, s.Value) })
+}
+
+// ParseSettings is like the package-level ParseSettings, but handles
+// conditional sections.
+func (p *Parser) ParseSettings(in io.Reader, cb func(s Setting)) error {
+	section, profile := "", ""
+	active := true
 	scanner := bufio.NewScanner(in)
 	lineno := 0
 	for scanner.Scan() {
@@ -60,10 +126,29 @@ func Parse(in io.Reader, cb func(key, value string)) error {
 			continue
 		}
 		if option[0] == '[' && option[len(option)-1] == ']' {
-			section = option[1:len(option)-1] + "."
-			if section == "main." { // main means no section
+			var conditions []string
+			var err error
+			profile, section, conditions, err = splitSection(
+				option[1 : len(option)-1])
+			if err != nil {
+				return fmt.Errorf("unable to parse flagfile line %d: %s",
+					lineno, err)
+			}
+			section += "."
+			if section == "main." || section == "." { // main means no section
 				section = ""
 			}
+			active, err = p.matches(conditions)
+			if err != nil {
+				return fmt.Errorf("unable to parse flagfile line %d: %s",
+					lineno, err)
+			}
+			if profile != "" && profile != p.Profile {
+				active = false
+			}
+			continue
+		}
+		if !active {
 			continue
 		}
 		parts := strings.SplitN(option, "=", 2)
@@ -74,7 +159,8 @@ func Parse(in io.Reader, cb func(key, value string)) error {
 		if section != "" {
 			name = section + name
 		}
-		cb(name, strings.TrimSpace(parts[1]))
+		cb(Setting{Key: name, Value: strings.TrimSpace(parts[1]),
+			Line: lineno, Profile: profile})
 	}
 	err := scanner.Err()
 	if err != nil {
@@ -82,3 +168,48 @@ func Parse(in io.Reader, cb func(key, value string)) error {
 	}
 	return nil
 }
+
+// splitSection splits a section header into its profile, the section name
+// and its conditions, if any.
+func splitSection(header string) (
+	profile, section string, conditions []string, err error) {
+	if strings.HasPrefix(header, "profile:") {
+		fields := strings.Fields(header)
+		profile = strings.TrimPrefix(fields[0], "profile:")
+		if profile == "" {
+			// an empty profile would apply the section to every profile
+			return "", "", nil, fmt.Errorf("empty profile name")
+		}
+		header = strings.Join(fields[1:], " ")
+	}
+	fields := strings.Fields(header)
+	for i, field := range fields {
+		if strings.HasPrefix(field, "@") {
+			return profile, strings.Join(fields[:i], " "), fields[i:], nil
+		}
+	}
+	return profile, header, nil, nil
+}
+
+// matches returns whether all of the given conditions match p's facts.
+func (p *Parser) matches(conditions []string) (bool, error) {
+	for _, condition := range conditions {
+		parts := strings.SplitN(strings.TrimPrefix(condition, "@"), "=", 2)
+		if !strings.HasPrefix(condition, "@") || len(parts) != 2 {
+			return false, fmt.Errorf("bad section condition %#v", condition)
+		}
+		fact, ok := p.Facts[parts[0]]
+		if !ok {
+			return false, nil
+		}
+		matched, err := path.Match(parts[1], fact)
+		if err != nil {
+			return false, fmt.Errorf("bad section condition %#v: %s",
+				condition, err)
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,127 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parseAll(t *testing.T, p *Parser, in string) []string {
+	var got []string
+	err := p.ParseSettings(strings.NewReader(in), func(s Setting) {
+		got = append(got, fmt.Sprintf("%d:%s=%s", s.Line, s.Key, s.Value))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestParseSettings(t *testing.T) {
+	got := parseAll(t, &Parser{}, `
+a = 1
+# b = 2
+[section]
+c = 3
+[main]
+d = 4
+`)
+	expected := []string{"2:a=1", "5:section.c=3", "7:d=4"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %v, expected %v", got, expected)
+	}
+}
+
+func TestParseConditionalSections(t *testing.T) {
+	p := &Parser{Facts: map[string]string{"host": "db-3", "env": "prod"}}
+	got := parseAll(t, p, `
+[server @host=db-*]
+a = 1
+[server @env=staging]
+a = 2
+[server @host=db-* @env=prod]
+b = 3
+[@env=prod]
+c = 4
+[other @missing=*]
+d = 5
+`)
+	expected := []string{"3:server.a=1", "7:server.b=3", "9:c=4"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %v, expected %v", got, expected)
+	}
+
+	err := p.Parse(strings.NewReader("[server @host]\n"),
+		func(key, value string) {})
+	if err == nil {
+		t.Fatal("expected an error for a bad condition")
+	}
+}
+
+func TestParseProfiles(t *testing.T) {
+	p := &Parser{Profile: "prod"}
+	got := parseAll(t, p, `
+a = 1
+[profile:prod]
+a = 2
+[profile:prod server]
+b = 3
+[profile:dev server]
+b = 4
+`)
+	expected := []string{"2:a=1", "4:a=2", "6:server.b=3"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %v, expected %v", got, expected)
+	}
+
+	for _, header := range []string{"[profile:]\n", "[profile: server]\n"} {
+		err := p.Parse(strings.NewReader(header+"b = 5\n"),
+			func(key, value string) {})
+		if err == nil {
+			t.Fatalf("expected an error for %#v", header)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	lookup := func(ref string) (string, error) {
+		if ref == "missing" {
+			return "", fmt.Errorf("missing")
+		}
+		return "<" + ref + ">", nil
+	}
+	for in, expected := range map[string]string{
+		"plain":                    "plain",
+		"${env:HOME}/data":         "<env:HOME>/data",
+		"$${not} $x ${a}${flag:b}": "${not} $x <a><flag:b>",
+		"trailing $":               "trailing $",
+	} {
+		got, err := Expand(in, lookup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expected {
+			t.Fatalf("expanding %#v: got %#v, expected %#v", in, got, expected)
+		}
+	}
+	for _, in := range []string{"${unterminated", "${missing}"} {
+		if _, err := Expand(in, lookup); err == nil {
+			t.Fatalf("expected an error expanding %#v", in)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Watch tells Load to keep polling every flagfile it loaded, including
+// flagfiles pulled in by chaining, and to Reload whenever one of them changes.
+// Include patterns are globbed again on every poll, so a new flagfile that
+// matches one also triggers a Reload. Loader.Close stops the polling.
+func Watch(interval time.Duration) Option {
+	return Option{watchInterval: interval}
+}
+
+// ReloadOnSignal tells Load to Reload whenever the process receives one of
+// the given signals, conventionally syscall.SIGHUP, until Loader.Close is
+// called.
+func ReloadOnSignal(sigs ...os.Signal) Option {
+	return Option{reloadSignals: sigs}
+}
+
+// OnChange registers a callback to be called whenever a Reload changes the
+// value of the named flag.
+func OnChange(flag_name string, cb func(old, new string)) {
+	CommandLine.OnChange(flag_name, cb)
+}
+
+// Reload reloads all of the sources originally loaded by Load, such as
+// flagfiles, and applies any values that changed. See Loader.Reload.
+func Reload() error {
+	return CommandLine.Reload()
+}
+
+// OnChange registers a callback to be called whenever a Reload changes the
+// value of the named flag or any of its aliases.
+func (l *Loader) OnChange(flag_name string, cb func(old, new string)) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.callbacks[flag_name] = append(l.callbacks[flag_name], cb)
+}
+
+// Reload reloads every source originally loaded by Load (except for the
+// command line) and applies only the values that changed since they were last
+// loaded. Flags set on the command line are never touched, and flags no
+// longer found in any source go back to their defaults. If any source can't
+// be loaded or any value can't be set, nothing is changed.
+func (l *Loader) Reload() error {
+	changes, err := l.reload()
+	if err != nil {
+		return err
+	}
+	l.notify(changes)
+	return nil
+}
+
+// change describes the effect of a Reload on a single flag.
+type change struct {
+	name string
+	old  string
+	new  string
+}
+
+func (l *Loader) reload() (changes []change, err error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if !l.loaded {
+		return nil, fmt.Errorf("flags not loaded")
+	}
+
+	ctx := l.context()
+	results := make([]map[string]Entry, len(l.sources))
+	for i, src := range l.sources {
+		if _, ok := src.(*commandLineSource); ok {
+			// the command line doesn't change
+			results[i] = l.results[i]
+			continue
+		}
+		entries, err := src.Load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = entries
+	}
+
+	err = l.checkDeprecated(results)
+	if err != nil {
+		return nil, err
+	}
+	values := l.merge(results)
+	// subcommand flags were already loaded
+	l.takeCommandEntries(values)
+	// secrets are read first so that references to them see their values
+	err = l.readSecrets(values)
+	if err != nil {
+		return nil, err
+	}
+	if l.cfg.interpolate {
+		err := l.interpolate(values)
+		if err != nil {
+			return nil, err
+		}
+	}
+	l.keepRuntime(values)
+	now_set := make(map[string]bool, len(values))
+	for name, val := range values {
+		if l.fs.Lookup(name) == nil {
+			if l.cfg.ignoreUnknowns {
+				delete(values, name)
+				continue
+			}
+			return nil, l.unknownFlag(name, val.entry.Path, val.entry.Line)
+		}
+		if val.active() {
+			now_set[name] = true
+		}
+	}
+	err = l.checkAliases(now_set)
+	if err != nil {
+		return nil, err
+	}
+	err = l.checkRequired(now_set)
+	if err != nil {
+		return nil, err
+	}
+	err = l.checkConstraints(now_set)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name, val := range values {
+		old, ok := l.values[name]
+		if !val.applied() && (!ok || old.entry.Value != val.entry.Value) {
+			names = append(names, name)
+		}
+	}
+	for name := range l.values {
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	// check every new value before changing any flag, so that a failed
+	// reload isn't seen by readers of dynamic flags or their subscribers
+	entries := make(map[string]Entry, len(names))
+	for _, name := range names {
+		if val, ok := values[name]; ok {
+			entries[name] = val.entry
+		} else {
+			entries[name] = Entry{Value: l.mustLookup(name).DefValue}
+		}
+	}
+	candidates, err := l.candidates(names, entries)
+	if err != nil {
+		return nil, err
+	}
+	prev := l.values
+	l.values = values
+	err = l.validate(candidates)
+	if err != nil {
+		l.values = prev
+		return nil, err
+	}
+
+	for _, name := range names {
+		f := l.mustLookup(name)
+		old := f.Value.String()
+		err = l.setFlag(name, entries[name])
+		if err != nil {
+			l.values = prev
+			l.rollback(changes)
+			return nil, err
+		}
+		changes = append(changes, change{name: name, old: old,
+			new: f.Value.String()})
+	}
+
+	// a flag can stop being set without its value changing
+	for name := range l.set_flags {
+		if !now_set[name] {
+			delete(l.set_flags, name)
+		}
+	}
+	for name := range now_set {
+		l.set_flags[name] = true
+	}
+	l.results = results
+	return changes, nil
+}
+
+// rollback undoes changes that were applied by a failed reload.
+func (l *Loader) rollback(changes []change) {
+	for i := len(changes) - 1; i >= 0; i-- {
+		l.setFlag(changes[i].name, Entry{Value: changes[i].old})
+	}
+}
+
+// notify calls the OnChange callbacks for every changed flag. Since aliases
+// share a value, a change to one name is reported under all of them.
+func (l *Loader) notify(changes []change) {
+	var cbs []func()
+	l.mtx.Lock()
+	for _, c := range changes {
+		c := c
+		for _, name := range l.aliasGroup(c.name) {
+			for _, cb := range l.callbacks[name] {
+				cb := cb
+				cbs = append(cbs, func() { cb(c.old, c.new) })
+			}
+		}
+	}
+	l.mtx.Unlock()
+	for _, cb := range cbs {
+		cb()
+	}
+}
+
+// fileStamp is what watch compares to tell whether a flagfile changed.
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime int64
+}
+
+// stampFlagfiles stamps every loaded flagfile, along with every file that
+// now matches an include pattern, so that new matches count as changes.
+func (l *Loader) stampFlagfiles() map[string]fileStamp {
+	l.mtx.Lock()
+	paths, globs := l.watchedFlagfiles()
+	l.mtx.Unlock()
+	return stampFiles(paths, globs)
+}
+
+// watchedFlagfiles returns the flagfiles and include patterns read by the
+// last load. l.mtx must be held.
+func (l *Loader) watchedFlagfiles() (paths, globs []string) {
+	for _, src := range l.sources {
+		if files, ok := src.(*flagfileSource); ok {
+			paths = append(paths, files.paths...)
+			globs = append(globs, files.globs...)
+		}
+	}
+	return paths, globs
+}
+
+func stampFiles(paths, globs []string) map[string]fileStamp {
+	for _, glob := range globs {
+		matches, err := filepath.Glob(glob)
+		if err == nil {
+			paths = append(paths, matches...)
+		}
+	}
+	stamps := make(map[string]fileStamp, len(paths))
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			stamps[path] = fileStamp{}
+			continue
+		}
+		stamps[path] = fileStamp{exists: true, size: fi.Size(),
+			modTime: fi.ModTime().UnixNano()}
+	}
+	return stamps
+}
+
+func stampsEqual(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, stamp := range a {
+		if other, ok := b[path]; !ok || other != stamp {
+			return false
+		}
+	}
+	return true
+}
+
+// watch polls the loaded flagfiles until done is closed, reloading when they
+// differ from stamps.
+func (l *Loader) watch(interval time.Duration, stamps map[string]fileStamp,
+	done <-chan struct{}) {
+	defer l.running.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if stampsEqual(stamps, l.stampFlagfiles()) {
+			continue
+		}
+		l.logReload("flagfile change")
+		// the chain of flagfiles may have changed too
+		stamps = l.stampFlagfiles()
+	}
+}
+
+// handleSignals reloads whenever one of the given signals arrives, until
+// done is closed.
+func (l *Loader) handleSignals(sigs []os.Signal, done <-chan struct{}) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	go func() {
+		defer l.running.Done()
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-ch:
+				l.logReload(sig.String())
+			}
+		}
+	}()
+}
+
+// Close stops the watching and signal handling started by the Watch and
+// ReloadOnSignal options, waiting for any reload in progress to finish.
+func (l *Loader) Close() {
+	l.mtx.Lock()
+	done := l.done
+	l.done = nil
+	l.mtx.Unlock()
+	if done != nil {
+		close(done)
+		l.running.Wait()
+	}
+}
+
+// logReload reloads and logs a summary of what changed and why.
+func (l *Loader) logReload(reason string) {
+	changes, err := l.reload()
+	if err != nil {
+		log.Printf("failed reloading flagfiles on %s, nothing changed: %s",
+			reason, err)
+		return
+	}
+	if len(changes) == 0 {
+		log.Printf("reloaded flagfiles on %s, nothing changed", reason)
+	} else {
+		summary := make([]string, 0, len(changes))
+		l.mtx.Lock()
+		for _, c := range changes {
+			summary = append(summary,
+				fmt.Sprintf("%s (%#v -> %#v)", c.name,
+					l.redact(c.name, c.old), l.redact(c.name, c.new)))
+		}
+		l.mtx.Unlock()
+		log.Printf("reloaded flagfiles on %s, changed %s", reason,
+			strings.Join(summary, ", "))
+	}
+	l.notify(changes)
+}
@@ -0,0 +1,131 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package flagfile_test
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spacemonkeygo/flagfile"
+)
+
+// logLines is a log output that hands each line to the test.
+type logLines chan string
+
+func (l logLines) Write(p []byte) (int, error) {
+	l <- string(p)
+	return len(p), nil
+}
+
+func (l logLines) waitFor(t *testing.T, substr string) {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line := <-l:
+			if strings.Contains(line, substr) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for log line %#v", substr)
+		}
+	}
+}
+
+func TestLoaderReloadOnSignal(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writeFlagfile(t, dir, "a.conf", "a = 1\n")
+
+	lines := make(logLines, 16)
+	log.SetOutput(lines)
+	defer log.SetOutput(os.Stderr)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	a := fs.Int("a", 0, "")
+	l := flagfile.NewLoader(fs)
+	err := l.LoadE(flagfile.Flagfile(path), flagfile.SkipArgs(),
+		flagfile.ReloadOnSignal(syscall.SIGHUP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	writeFlagfile(t, dir, "a.conf", "a = 2\n")
+	err = syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines.waitFor(t, "reloaded flagfiles on hangup, changed a")
+	if *a != 2 {
+		t.Fatalf("signal reload not applied: %d", *a)
+	}
+
+	writeFlagfile(t, dir, "a.conf", "a = 3\nb\n")
+	err = syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines.waitFor(t, "failed reloading flagfiles on hangup, nothing changed")
+	if *a != 2 {
+		t.Fatalf("failed signal reload was applied: %d", *a)
+	}
+}
+
+func TestLoaderWatchIncludeGlob(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	err := os.Mkdir(filepath.Join(dir, "conf.d"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFlagfile(t, dir, "conf.d/a.conf", "a = 1\n")
+	path := writeFlagfile(t, dir, "main.conf", "include = conf.d/*.conf\n")
+
+	lines := make(logLines, 16)
+	log.SetOutput(lines)
+	defer log.SetOutput(os.Stderr)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	a := fs.Int("a", 0, "")
+	l := flagfile.NewLoader(fs)
+	err = l.LoadE(flagfile.Flagfile(path), flagfile.SkipArgs(),
+		flagfile.Watch(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	writeFlagfile(t, dir, "conf.d/b.conf", "a = 2\n")
+	lines.waitFor(t, "reloaded flagfiles on flagfile change, changed a")
+	if *a != 2 {
+		t.Fatalf("new included flagfile not applied: %d", *a)
+	}
+
+	l.Close()
+	writeFlagfile(t, dir, "conf.d/c.conf", "a = 3\n")
+	time.Sleep(50 * time.Millisecond)
+	if *a != 2 {
+		t.Fatalf("flagfiles watched after Close: %d", *a)
+	}
+}
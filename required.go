@@ -0,0 +1,92 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"flag"
+	"sort"
+
+	"github.com/spacemonkeygo/flagfile/utils"
+)
+
+// Require marks the named flags as required. Load fails with a
+// *MissingFlagsError naming every required flag that wasn't actively set,
+// through any of its aliases. Flags created by utils.Setup from fields tagged
+// with required:"true" are required too. Requiring a flag that is never
+// defined makes Load fail with an *UnknownFlagError.
+func Require(flag_names ...string) {
+	CommandLine.Require(flag_names...)
+}
+
+// IsRequired returns whether the named flag is required.
+func IsRequired(flag_name string) bool {
+	return CommandLine.IsRequired(flag_name)
+}
+
+// Require marks the named flags as required. See the top-level Require.
+func (l *Loader) Require(flag_names ...string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	for _, flag_name := range flag_names {
+		l.required[flag_name] = true
+	}
+}
+
+// IsRequired returns whether the named flag is required.
+func (l *Loader) IsRequired(flag_name string) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.isRequired(flag_name)
+}
+
+func (l *Loader) isRequired(flag_name string) bool {
+	// utils.Setup only defines flags on the default flag set
+	return l.required[flag_name] ||
+		(l.fs == flag.CommandLine && utils.IsRequired(flag_name))
+}
+
+// checkRequired returns an error naming every required flag with no name in
+// its alias group in the given set, or an *UnknownFlagError if a required
+// flag was never defined.
+func (l *Loader) checkRequired(set map[string]bool) error {
+	names := make([]string, 0, len(l.required))
+	for flag_name := range l.required {
+		names = append(names, flag_name)
+	}
+	sort.Strings(names)
+	for _, flag_name := range names {
+		if l.fs.Lookup(flag_name) == nil {
+			return l.unknownFlag(flag_name, "", 0)
+		}
+	}
+	var missing []string
+	l.fs.VisitAll(func(f *flag.Flag) {
+		if l.isAlias(f.Name) || l.isDeprecated(f.Name) ||
+			!l.isRequired(f.Name) {
+			return
+		}
+		for _, name := range l.aliasGroup(f.Name) {
+			if set[name] {
+				return
+			}
+		}
+		missing = append(missing, f.Name)
+	})
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return &MissingFlagsError{Names: missing}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+// secretPrefix marks a value that should be read from a file instead.
+const secretPrefix = "@file:"
+
+// redacted is shown instead of the value of a secret flag.
+const redacted = "<redacted>"
+
+// Secret marks the named flags as secret, so that their values are redacted
+// by Dump, usage output and errors. Flags loaded from a value of the form
+// @file:path are marked as secret automatically.
+func Secret(flag_names ...string) {
+	CommandLine.Secret(flag_names...)
+}
+
+// IsSecret returns whether the named flag is secret.
+func IsSecret(flag_name string) bool {
+	return CommandLine.IsSecret(flag_name)
+}
+
+// Secret marks the named flags as secret. See the top-level Secret.
+func (l *Loader) Secret(flag_names ...string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	for _, flag_name := range flag_names {
+		l.secrets[flag_name] = true
+	}
+}
+
+// IsSecret returns whether the named flag, or any of its aliases, is secret.
+func (l *Loader) IsSecret(flag_name string) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.isSecret(flag_name)
+}
+
+func (l *Loader) isSecret(flag_name string) bool {
+	if dep, ok := l.deprecated[flag_name]; ok {
+		flag_name = dep.replacement
+	}
+	for _, name := range l.aliasGroup(flag_name) {
+		if l.secrets[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// redact returns val, or a placeholder if the named flag is secret.
+func (l *Loader) redact(flag_name, val string) string {
+	if l.isSecret(flag_name) {
+		return redacted
+	}
+	return val
+}
+
+// readSecrets replaces every actively set value of the form @file:path that
+// didn't come from the command line with the contents of the file at path,
+// minus any trailing newline, and marks those flags as secret. The reference
+// is kept in the value's raw field.
+func (l *Loader) readSecrets(values map[string]value) error {
+	for _, name := range sortedNames(values) {
+		val := values[name]
+		if !val.active() || val.applied() ||
+			!strings.HasPrefix(val.entry.Value, secretPrefix) {
+			continue
+		}
+		path := strings.TrimPrefix(val.entry.Value, secretPrefix)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return &SecretError{Name: name,
+				Path: val.entry.Path, Line: val.entry.Line, Err: err}
+		}
+		if val.raw == "" {
+			val.raw = val.entry.Value
+		}
+		val.entry.Value = strings.TrimSuffix(
+			strings.TrimSuffix(string(data), "\n"), "\r")
+		values[name] = val
+		l.secrets[name] = true
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Source is somewhere flag values come from, such as the command line, the
+// environment, flagfiles or a configuration service. Load asks each of its
+// sources for values and, for every flag, uses the value from the first
+// source that has one.
+type Source interface {
+	// Name describes the kind of source, such as "cmdline" or "file".
+	Name() string
+	// Load returns the values this source has, keyed by flag name.
+	Load(ctx context.Context) (map[string]Entry, error)
+}
+
+// Entry is a single flag value provided by a Source.
+type Entry struct {
+	Value string
+	// Path and Line optionally locate where the value came from, such as the
+	// flagfile and line number it was read from.
+	Path string
+	Line int
+}
+
+// Sources tells Load exactly which sources to load flags from, in order of
+// precedence, highest first. Without this option Load uses CommandLineSource,
+// EnvSource (if EnvPrefix was given), FlagfileSource and DefaultSource, and
+// the other options given to Load configure those sources.
+func Sources(srcs ...Source) Option {
+	return Option{sources: srcs}
+}
+
+// CommandLineSource returns a Source for flags set in the process arguments
+// (or those given by Arguments). It parses the arguments with the Loader's
+// flag set, so the values it returns are already set.
+func CommandLineSource() Source { return &commandLineSource{} }
+
+// EnvSource returns a Source for flags set in environment variables with the
+// given prefix. See EnvName. The flagfile, flagout and flagprofile flags
+// can't be set from the environment.
+func EnvSource(prefix string) Source { return &envSource{prefix: prefix} }
+
+// FlagfileSource returns a Source for flags set in the given flagfiles, as
+// well as any flagfiles named by the flagfile flag. It uses the profile
+// sections named by the flagprofile flag or the Profile option.
+func FlagfileSource(paths ...string) Source {
+	return &flagfileSource{flagfiles: paths}
+}
+
+// DefaultSource returns a Source for the default value of every flag. Flags
+// whose value comes from DefaultSource are left alone and aren't considered
+// actively set.
+func DefaultSource() Source { return &defaultSource{} }
+
+type loaderKey struct{}
+
+// context returns the context the Loader's sources are loaded with.
+func (l *Loader) context() context.Context {
+	return context.WithValue(context.Background(), loaderKey{}, l)
+}
+
+func loaderFromContext(ctx context.Context) (*Loader, error) {
+	l, ok := ctx.Value(loaderKey{}).(*Loader)
+	if !ok {
+		return nil, fmt.Errorf("flagfile: sources must be loaded by a Loader")
+	}
+	return l, nil
+}
+
+type commandLineSource struct{}
+
+func (s *commandLineSource) Name() string { return "cmdline" }
+
+func (s *commandLineSource) Load(ctx context.Context) (
+	map[string]Entry, error) {
+	l, err := loaderFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	flag_args, positionals := l.splitArgs(l.cfg.args, l.cfg.interspersed)
+	for _, arg := range flag_args {
+		if arg == "--help-all" || arg == "-help-all" {
+			l.cfg.full_usage()
+			os.Exit(2)
+		}
+	}
+	// Parse reports unknown flags itself, so just add suggestions
+	unknown := l.checkArgs(flag_args)
+	l.fs.Usage = func() {
+		if unknown != nil && len(unknown.Suggestions) > 0 {
+			fmt.Fprintf(os.Stderr, "did you mean %s?\n",
+				strings.Join(unknown.Suggestions, " or "))
+		}
+		l.cfg.short_usage()
+	}
+	// the positionals go after "--" so that the flag set's Args has them
+	err = l.fs.Parse(append(append(flag_args, "--"), positionals...))
+	if err != nil {
+		if unknown != nil {
+			return nil, unknown
+		}
+		return nil, err
+	}
+	entries := make(map[string]Entry)
+	l.fs.Visit(func(f *flag.Flag) {
+		entries[f.Name] = Entry{Value: f.Value.String()}
+	})
+	return entries, nil
+}
+
+type envSource struct {
+	prefix string
+}
+
+func (s *envSource) Name() string { return "env" }
+
+func (s *envSource) Load(ctx context.Context) (map[string]Entry, error) {
+	l, err := loaderFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]Entry)
+	l.fs.VisitAll(func(f *flag.Flag) {
+		if isWithheld(f.Name) {
+			// these are read before any source is loaded
+			return
+		}
+		env_name := EnvName(s.prefix, f.Name)
+		if value, ok := os.LookupEnv(env_name); ok {
+			entries[f.Name] = Entry{Value: value, Path: "$" + env_name}
+		}
+	})
+	return entries, nil
+}
+
+type flagfileSource struct {
+	flagfiles []string
+	// paths is every flagfile read by the last Load, and globs every include
+	// pattern, for watching
+	paths []string
+	globs []string
+	// shadowed is every entry the last Load found that a later line in the
+	// flagfiles overrode, for provenance
+	shadowed map[string][]Entry
+}
+
+func (s *flagfileSource) Name() string { return "file" }
+
+func (s *flagfileSource) Load(ctx context.Context) (
+	map[string]Entry, error) {
+	l, err := loaderFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	flagfiles := append(append([]string(nil), s.flagfiles...),
+		strings.Split(*l.flagfile, ",")...)
+	profile := *l.flagprofile
+	if profile == "" {
+		profile = l.cfg.profile
+	}
+	settings, paths, globs, err := readFlagfiles(flagfiles, l.cfg, profile)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]Entry)
+	shadowed := make(map[string][]Entry)
+	// settings from profile sections override the rest
+	for _, in_profile := range []bool{false, true} {
+		seen := make(map[string]bool)
+		for _, setting := range settings {
+			if (setting.profile != "") != in_profile {
+				continue
+			}
+			name := setting.name
+			entry := Entry{
+				Value: setting.value, Path: setting.path, Line: setting.line}
+			prev, ok := entries[name]
+			if ok && seen[name] {
+				keep, err := l.cfg.duplicates.resolve(name, prev, entry)
+				if err != nil {
+					return nil, err
+				}
+				if keep == prev {
+					shadowed[name] = append(shadowed[name], entry)
+					continue
+				}
+			}
+			if ok {
+				shadowed[name] = append(shadowed[name], prev)
+			}
+			entries[name] = entry
+			seen[name] = true
+		}
+	}
+	s.paths = paths
+	s.globs = globs
+	s.shadowed = shadowed
+	return entries, nil
+}
+
+type defaultSource struct{}
+
+func (s *defaultSource) Name() string { return "default" }
+
+func (s *defaultSource) Load(ctx context.Context) (map[string]Entry, error) {
+	l, err := loaderFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]Entry)
+	l.fs.VisitAll(func(f *flag.Flag) {
+		entries[f.Name] = Entry{Value: f.DefValue}
+	})
+	return entries, nil
+}
+
+// value is the Entry a flag's value comes from, along with its Source and
+// the lower precedence entries it overrode. If the entry's value was
+// interpolated, raw is the original text, and if the entry was given for a
+// deprecated name, via is that name.
+type value struct {
+	entry    Entry
+	source   Source
+	overrode []Provenance
+	raw      string
+	via      string
+}
+
+// active returns whether the value counts as actively set.
+func (v value) active() bool {
+	_, ok := v.source.(*defaultSource)
+	return !ok
+}
+
+// applied returns whether the value was already set by its source.
+func (v value) applied() bool {
+	_, ok := v.source.(*commandLineSource)
+	return ok
+}
+
+// merge picks the value of every flag from the highest precedence source
+// that has one. Entries for deprecated names count as entries for their
+// replacements, unless the same source has an entry for the replacement.
+func (l *Loader) merge(results []map[string]Entry) map[string]value {
+	values := make(map[string]value)
+	for i, entries := range results {
+		src := l.sources[i]
+		for entry_name, entry := range entries {
+			name, via := entry_name, ""
+			if dep, ok := l.deprecated[entry_name]; ok {
+				if _, ok := entries[dep.replacement]; ok {
+					continue
+				}
+				name, via = dep.replacement, entry_name
+			}
+			val, ok := values[name]
+			if !ok {
+				val = value{entry: entry, source: src, via: via}
+			} else if _, ok := src.(*defaultSource); !ok {
+				val.overrode = append(val.overrode, provenance(src, entry))
+			}
+			if files, ok := src.(*flagfileSource); ok {
+				shadowed := files.shadowed[entry_name]
+				for j := len(shadowed) - 1; j >= 0; j-- {
+					val.overrode = append(val.overrode,
+						provenance(src, shadowed[j]))
+				}
+			}
+			values[name] = val
+		}
+	}
+	return values
+}
+
+func sortedNames(values map[string]value) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
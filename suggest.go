@@ -0,0 +1,157 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"flag"
+	"sort"
+	"strings"
+)
+
+// maxSuggestions is how many suggestions an UnknownFlagError carries at most.
+const maxSuggestions = 3
+
+// unknownFlag returns an UnknownFlagError for the named flag, with
+// suggestions for what was meant.
+func (l *Loader) unknownFlag(flag_name, path string,
+	line int) *UnknownFlagError {
+	return &UnknownFlagError{Name: flag_name, Path: path, Line: line,
+		Suggestions: l.suggest(flag_name)}
+}
+
+type suggestion struct {
+	name     string
+	distance int
+}
+
+// suggest returns the defined flags closest to the unknown flag name. If no
+// flag is close, it returns the closest sections instead, as "[section]".
+func (l *Loader) suggest(flag_name string) []string {
+	max_distance := len(flag_name) / 3
+	if max_distance < 1 {
+		max_distance = 1
+	}
+	var flags, sections []suggestion
+	seen_sections := make(map[string]bool)
+	section, _ := splitName(flag_name)
+	l.fs.VisitAll(func(f *flag.Flag) {
+		if l.isDeprecated(f.Name) {
+			return
+		}
+		if d := distance(flag_name, f.Name); d <= max_distance {
+			flags = append(flags, suggestion{name: f.Name, distance: d})
+		}
+		other, _ := splitName(f.Name)
+		if section == "" || other == "" || seen_sections[other] {
+			return
+		}
+		seen_sections[other] = true
+		if d := distance(section, other); d <= max_distance {
+			sections = append(sections,
+				suggestion{name: "[" + other + "]", distance: d})
+		}
+	})
+	if len(flags) == 0 {
+		flags = sections
+	}
+	sort.Sort(byDistance(flags))
+	if len(flags) > maxSuggestions {
+		flags = flags[:maxSuggestions]
+	}
+	var names []string
+	for _, s := range flags {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+// splitName splits a flag name into its section and the rest.
+func splitName(flag_name string) (section, name string) {
+	pos := strings.LastIndex(flag_name, ".")
+	if pos == -1 {
+		return "", flag_name
+	}
+	return flag_name[:pos], flag_name[pos+1:]
+}
+
+type byDistance []suggestion
+
+func (s byDistance) Len() int      { return len(s) }
+func (s byDistance) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byDistance) Less(i, j int) bool {
+	if s[i].distance != s[j].distance {
+		return s[i].distance < s[j].distance
+	}
+	return s[i].name < s[j].name
+}
+
+// distance returns the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// checkArgs returns an UnknownFlagError for the first flag in args that isn't
+// defined, which flag.FlagSet.Parse only reports as "flag provided but not
+// defined".
+func (l *Loader) checkArgs(args []string) *UnknownFlagError {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) < 2 || arg[0] != '-' || arg == "--" {
+			return nil
+		}
+		name := strings.TrimPrefix(arg[1:], "-")
+		if pos := strings.Index(name, "="); pos != -1 {
+			name = name[:pos]
+		}
+		if name == "" || name[0] == '-' || name[0] == '=' {
+			// let Parse report the bad syntax
+			return nil
+		}
+		if l.fs.Lookup(name) == nil && name != "help" && name != "h" {
+			return l.unknownFlag(name, "", 0)
+		}
+		if l.takesValue(arg) {
+			// the next argument is this flag's value
+			i++
+		}
+	}
+	return nil
+}
@@ -21,7 +21,7 @@ import (
 	"strings"
 )
 
-func formatFlag(f *flag.Flag) string {
+func (l *Loader) formatFlag(f *flag.Flag) string {
 	// Two spaces before -; see next two comments.
 	s := fmt.Sprintf("  -%s", f.Name)
 	name, usage := flag.UnquoteUsage(f)
@@ -38,19 +38,24 @@ func formatFlag(f *flag.Flag) string {
 		s += "\n    \t"
 	}
 	s += usage
+	if l.isRequired(f.Name) {
+		s += " (required)"
+	}
 	switch f.DefValue {
 	case "0", "false", "":
 	default:
-		s += fmt.Sprintf(" (default %#v)", f.DefValue)
+		s += fmt.Sprintf(" (default %#v)", l.redact(f.Name, f.DefValue))
 	}
 	return s
 }
 
-func header() { fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0]) }
+func (l *Loader) header() {
+	fmt.Fprintf(os.Stderr, "Usage of %s:\n", l.fs.Name())
+}
 
 func isWithheld(name string) bool {
 	switch name {
-	case "flagfile", "flagout":
+	case "flagfile", "flagout", "flagprofile":
 		return true
 	default:
 		return false
@@ -59,34 +64,55 @@ func isWithheld(name string) bool {
 
 // ShortUsage only outputs to stderr flags without "." and withholds some
 // system flags.
-func ShortUsage() {
-	header()
-	flag.VisitAll(func(f *flag.Flag) {
-		if strings.Contains(f.Name, ".") || isWithheld(f.Name) {
+func ShortUsage() { CommandLine.ShortUsage() }
+
+// FullUsage outputs full usage information to stderr. All flags.
+func FullUsage() { CommandLine.FullUsage() }
+
+// ShortUsage only outputs to stderr the Loader's flags without "." and
+// withholds some system flags.
+func (l *Loader) ShortUsage() {
+	l.header()
+	l.fs.VisitAll(func(f *flag.Flag) {
+		if strings.Contains(f.Name, ".") || isWithheld(f.Name) ||
+			l.isDeprecated(f.Name) {
 			return
 		}
-		fmt.Fprint(os.Stderr, formatFlag(f), "\n")
+		fmt.Fprint(os.Stderr, l.formatFlag(f), "\n")
 	})
+	l.constraintUsage()
+	if len(l.commands) > 0 {
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Commands:")
+	}
+	for _, cmd := range l.sortedCommands() {
+		fmt.Fprintf(os.Stderr, "  %s\n", cmd.name)
+	}
 	fmt.Fprintln(os.Stderr)
 	fmt.Fprintln(os.Stderr, "  -help-all")
 	fmt.Fprintln(os.Stderr, "    \tShow all possible flags.")
 }
 
-// FullUsage outputs full usage information to stderr. All flags.
-func FullUsage() {
-	header()
+// FullUsage outputs full usage information about the Loader's flags to
+// stderr. All flags, with deprecated flags listed last.
+func (l *Loader) FullUsage() {
+	l.header()
 
-	var withheld []string
+	var withheld, deprecated []string
 
-	flag.VisitAll(func(f *flag.Flag) {
+	l.fs.VisitAll(func(f *flag.Flag) {
+		if l.isDeprecated(f.Name) {
+			deprecated = append(deprecated, l.formatFlag(f))
+			return
+		}
 		if strings.Contains(f.Name, ".") {
 			return
 		}
 		if isWithheld(f.Name) {
-			withheld = append(withheld, formatFlag(f))
+			withheld = append(withheld, l.formatFlag(f))
 			return
 		}
-		fmt.Fprint(os.Stderr, formatFlag(f), "\n")
+		fmt.Fprint(os.Stderr, l.formatFlag(f), "\n")
 	})
 
 	if len(withheld) > 0 {
@@ -97,16 +123,48 @@ func FullUsage() {
 	}
 
 	current_section := ""
-	flag.VisitAll(func(f *flag.Flag) {
+	l.fs.VisitAll(func(f *flag.Flag) {
 		pos := strings.LastIndex(f.Name, ".")
 		if pos == -1 {
 			return
 		}
+		if l.isDeprecated(f.Name) {
+			return
+		}
 		section := f.Name[:pos]
 		if section != current_section {
 			current_section = section
 			fmt.Fprintln(os.Stderr)
 		}
-		fmt.Fprint(os.Stderr, formatFlag(f), "\n")
+		fmt.Fprint(os.Stderr, l.formatFlag(f), "\n")
 	})
+
+	if len(deprecated) > 0 {
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Deprecated flags:")
+	}
+	for _, msg := range deprecated {
+		fmt.Fprint(os.Stderr, msg, "\n")
+	}
+
+	l.constraintUsage()
+
+	for _, cmd := range l.sortedCommands() {
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintf(os.Stderr, "Flags for command %s:\n", cmd.name)
+		cmd.loader.fs.VisitAll(func(f *flag.Flag) {
+			fmt.Fprint(os.Stderr, cmd.loader.formatFlag(f), "\n")
+		})
+	}
+}
+
+func (l *Loader) constraintUsage() {
+	if len(l.constraints) == 0 {
+		return
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Constraints:")
+	for _, c := range l.constraints {
+		fmt.Fprintf(os.Stderr, "  %s\n", c)
+	}
 }
@@ -24,6 +24,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -38,6 +39,19 @@ func getParams(tags reflect.StructTag) (defaultStr, usage string) {
 	return
 }
 
+var (
+	requiredMtx sync.Mutex
+	required    = make(map[string]bool)
+)
+
+// IsRequired returns whether Setup created the named flag from a field tagged
+// with required:"true". flagfile.Load fails if such a flag isn't set.
+func IsRequired(flag_name string) bool {
+	requiredMtx.Lock()
+	defer requiredMtx.Unlock()
+	return required[flag_name]
+}
+
 // Setup is meant to be called in init or in some other place prior to
 // flagfile.Load() or flags.Parse(). Setup will take a struct and through
 // reflect, create flags for all of the fields in the struct. The given prefix
@@ -46,6 +60,9 @@ func getParams(tags reflect.StructTag) (defaultStr, usage string) {
 // flag.Parse/flagfile.Load is called.
 //
 // If a prefix is non-zero length, it is joined with a separating period.
+//
+// Fields may be tagged with default, usage and required. Flags for fields
+// tagged with required:"true" must be set for flagfile.Load to succeed.
 func Setup(prefix string, x interface{}) {
 	rv := reflect.ValueOf(x).Elem()
 	if rv.Kind() != reflect.Struct {
@@ -63,6 +80,11 @@ func Setup(prefix string, x interface{}) {
 			flagName = fmt.Sprintf("%s.%s", prefix, flagName)
 		}
 		defaultStr, usage := getParams(ftyp.Tag)
+		if ftyp.Tag.Get("required") == "true" {
+			requiredMtx.Lock()
+			required[flagName] = true
+			requiredMtx.Unlock()
+		}
 		ivar := field.Addr().Interface()
 		if v, ok := ivar.(flag.Value); ok {
 			flag.Var(v, flagName, usage)
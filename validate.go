@@ -0,0 +1,203 @@
+// Copyright (C) 2014 Space Monkey, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flagfile
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Validate registers a check for the named flag's value. Once every source
+// and alias has been applied, Load runs every check and fails with
+// ValidationErrors describing all of the values that didn't pass, along with
+// where they came from. Checks also run on Reload, which changes nothing if
+// any fail.
+func Validate(flag_name string, check func(flag.Getter) error) {
+	CommandLine.Validate(flag_name, check)
+}
+
+// Validate registers a check for the named flag's value. See the top-level
+// Validate.
+func (l *Loader) Validate(flag_name string, check func(flag.Getter) error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.loaded {
+		panic(fmt.Errorf("flags already loaded"))
+	}
+	l.validators[flag_name] = append(l.validators[flag_name], check)
+}
+
+// Range returns a check that a numeric flag, including a time.Duration flag
+// in nanoseconds, is between min and max inclusive.
+func Range(min, max float64) func(flag.Getter) error {
+	return func(g flag.Getter) error {
+		n, ok := number(g.Get())
+		if !ok {
+			return fmt.Errorf("not a number")
+		}
+		if n < min || n > max {
+			return fmt.Errorf("must be between %v and %v", min, max)
+		}
+		return nil
+	}
+}
+
+func number(val interface{}) (float64, bool) {
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// OneOf returns a check that a flag's value is one of the given choices.
+func OneOf(choices ...string) func(flag.Getter) error {
+	return func(g flag.Getter) error {
+		if !containsString(choices, g.String()) {
+			return fmt.Errorf("must be one of %s", strings.Join(choices, ", "))
+		}
+		return nil
+	}
+}
+
+// Matches returns a check that a flag's value matches the given regular
+// expression. It panics if pattern doesn't compile.
+func Matches(pattern string) func(flag.Getter) error {
+	re := regexp.MustCompile(pattern)
+	return func(g flag.Getter) error {
+		if !re.MatchString(g.String()) {
+			return fmt.Errorf("must match %s", pattern)
+		}
+		return nil
+	}
+}
+
+// NonEmpty is a check that a flag's value isn't empty.
+func NonEmpty(g flag.Getter) error {
+	if g.String() == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	return nil
+}
+
+// PathExists is a check that a flag's value names an existing file or
+// directory.
+func PathExists(g flag.Getter) error {
+	_, err := os.Stat(g.String())
+	return err
+}
+
+// stringGetter adapts a flag.Value that isn't a flag.Getter.
+type stringGetter struct {
+	flag.Value
+}
+
+func (g stringGetter) Get() interface{} { return g.String() }
+
+// textValue is a read-only flag.Value holding plain text.
+type textValue string
+
+func (v textValue) String() string   { return string(v) }
+func (v textValue) Get() interface{} { return string(v) }
+
+func (v textValue) Set(string) error {
+	return fmt.Errorf("read only")
+}
+
+// candidate returns a new Value of the same type as the flag's, set to s, so
+// that s can be checked before the flag itself changes. Values of types that
+// can't be made this way are checked as plain text.
+func candidate(f *flag.Flag, s string) (flag.Value, error) {
+	v := f.Value
+	if frozen, ok := v.(*frozenValue); ok {
+		v = frozen.Value
+	}
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		if c, ok := reflect.New(t.Elem()).Interface().(flag.Value); ok {
+			return c, c.Set(s)
+		}
+	}
+	return textValue(s), nil
+}
+
+// candidates returns the values the named flags would have once set, in
+// order, to the given entries, keyed by every name in their alias groups.
+func (l *Loader) candidates(names []string,
+	entries map[string]Entry) (map[string]flag.Value, error) {
+	values := make(map[string]flag.Value)
+	for _, name := range names {
+		e := entries[name]
+		c, err := candidate(l.mustLookup(name), e.Value)
+		if err != nil {
+			return nil, &ValueError{Name: name, Value: l.redact(name, e.Value),
+				Path: e.Path, Line: e.Line, Err: err}
+		}
+		for _, alias := range l.aliasGroup(name) {
+			values[alias] = c
+		}
+	}
+	return values, nil
+}
+
+// validate runs every registered check against the flags' values, or their
+// candidate values if they have one.
+func (l *Loader) validate(candidates map[string]flag.Value) error {
+	names := make([]string, 0, len(l.validators))
+	for name := range l.validators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs ValidationErrors
+	for _, name := range names {
+		f := l.fs.Lookup(name)
+		if f == nil {
+			return l.unknownFlag(name, "", 0)
+		}
+		v, ok := candidates[name]
+		if !ok {
+			v = f.Value
+		}
+		g, ok := v.(flag.Getter)
+		if !ok {
+			g = stringGetter{Value: v}
+		}
+		for _, check := range l.validators[name] {
+			err := check(g)
+			if err != nil {
+				errs = append(errs, &ValidationError{Name: name,
+					Value:  l.redact(name, v.String()),
+					Origin: l.origin(name), Err: err})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}